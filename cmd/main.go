@@ -3,10 +3,13 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/DerRomtester/testproject-golang-webapi-1/handler"
 	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/lint"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
 
 	"github.com/spf13/viper"
 )
@@ -22,28 +25,105 @@ func GetConfig() (handler.ServerConfig, database.DatabaseConnection) {
 		fmt.Println("error config file: default \n", err)
 	}
 	db := database.DatabaseConnection{
-		User:     viper.GetString("DatabaseConnection.User"),
-		Password: viper.GetString("DatabaseConnection.Password"),
-		Host:     viper.GetString("DatabaseConnection.Host"),
-		Port:     viper.GetString("DatabaseConnection.Port"),
-		Timeout:  viper.GetDuration("DatabaseConnection.Timeout") * time.Second,
+		Backend:          viper.GetString("DatabaseConnection.Backend"),
+		Path:             viper.GetString("DatabaseConnection.Path"),
+		User:             viper.GetString("DatabaseConnection.User"),
+		Password:         viper.GetString("DatabaseConnection.Password"),
+		Host:             viper.GetString("DatabaseConnection.Host"),
+		Port:             viper.GetString("DatabaseConnection.Port"),
+		Timeout:          viper.GetDuration("DatabaseConnection.Timeout") * time.Second,
+		Migrate:          viper.GetBool("DatabaseConnection.Migrate"),
+		OperationTimeout: viper.GetDuration("DatabaseConnection.OperationTimeout") * time.Second,
+		HealthInterval:   viper.GetDuration("DatabaseConnection.HealthInterval") * time.Second,
+		URI:              viper.GetString("DatabaseConnection.URI"),
+		Hosts:            viper.GetStringSlice("DatabaseConnection.Hosts"),
+		SRV:              viper.GetBool("DatabaseConnection.SRV"),
+		ReplicaSet:       viper.GetString("DatabaseConnection.ReplicaSet"),
+		AuthSource:       viper.GetString("DatabaseConnection.AuthSource"),
+		TLS:              viper.GetBool("DatabaseConnection.TLS"),
+		TLSCAFile:        viper.GetString("DatabaseConnection.TLSCAFile"),
+		TLSInsecure:      viper.GetBool("DatabaseConnection.TLSInsecure"),
+		MaxPoolSize:      viper.GetUint64("DatabaseConnection.MaxPoolSize"),
+		ReadPreference:   viper.GetString("DatabaseConnection.ReadPreference"),
+		Names: database.Names{
+			Prefix:               viper.GetString("DatabaseConnection.Names.Prefix"),
+			DeviceDatabase:       viper.GetString("DatabaseConnection.Names.DeviceDatabase"),
+			DeviceCollection:     viper.GetString("DatabaseConnection.Names.DeviceCollection"),
+			DeviceTypeCollection: viper.GetString("DatabaseConnection.Names.DeviceTypeCollection"),
+			ProjectCollection:    viper.GetString("DatabaseConnection.Names.ProjectCollection"),
+			UserDatabase:         viper.GetString("DatabaseConnection.Names.UserDatabase"),
+			UserCollection:       viper.GetString("DatabaseConnection.Names.UserCollection"),
+			SessionCollection:    viper.GetString("DatabaseConnection.Names.SessionCollection"),
+			MigrationCollection:  viper.GetString("DatabaseConnection.Names.MigrationCollection"),
+		},
+		Retry: database.Backoff{
+			Initial: viper.GetDuration("DatabaseConnection.Retry.Initial") * time.Millisecond,
+			Max:     viper.GetDuration("DatabaseConnection.Retry.Max") * time.Second,
+		},
 	}
 
 	srv := handler.ServerConfig{
-		Domain: viper.GetString("Server.Domain"),
-		Port:   viper.GetString("Server.Port"),
+		Domain:      viper.GetString("Server.Domain"),
+		Port:        viper.GetString("Server.Port"),
+		MaxPageSize: viper.GetInt64("Server.MaxPageSize"),
+		Validation: validation.Rules{
+			InstallationPositions: viper.GetStringSlice("Validation.InstallationPositions"),
+			Temperature:           rangeConfig("Validation.Temperature"),
+			AxisNumber:            rangeConfig("Validation.AxisNumber"),
+			RequiredAxes:          rangeConfig("Validation.RequiredAxes"),
+			Quantity:              rangeConfig("Validation.Quantity"),
+			SlotCount:             rangeConfig("Validation.SlotCount"),
+		},
+	}
+
+	var rules []lint.Config
+	if err := viper.UnmarshalKey("Rules", &rules); err != nil {
+		log.Fatal("error config Rules: ", err)
+	}
+	srv.Rules, err = lint.Compile(rules)
+	if err != nil {
+		log.Fatal("error config Rules: ", err)
 	}
 	return srv, db
 }
 
+// rangeConfig reads the range at key. It is nil when the range is not
+// configured, a range with only one bound or with Min above Max is rejected.
+func rangeConfig(key string) *validation.Range {
+	hasMin, hasMax := viper.IsSet(key+".Min"), viper.IsSet(key+".Max")
+	if !hasMin && !hasMax {
+		return nil
+	}
+	if !hasMin || !hasMax {
+		log.Fatalf("error config %s: Min and Max must both be set", key)
+	}
+	r := validation.Range{Min: viper.GetInt(key + ".Min"), Max: viper.GetInt(key + ".Max")}
+	if r.Min > r.Max {
+		log.Fatalf("error config %s: Min %d is greater than Max %d", key, r.Min, r.Max)
+	}
+	return &r
+}
+
 func main() {
 	srv, db := GetConfig()
-	client, err := db.ConnectDB()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := RunMigrate(db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	client, err := db.Open()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if db.Migrate {
+		go migrateOnStartup(client)
+	}
+
 	srv.Run(client)
 
 	if err != nil {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/migrations"
+)
+
+const migrateTimeout = 5 * time.Minute
+
+// RunMigrate implements the migrate subcommand:
+//
+//	devices-api migrate [up|status] [-dry-run]
+func RunMigrate(db database.DatabaseConnection, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only print the migrations that would be applied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	command := fs.Arg(0)
+	if fs.NArg() > 1 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
+	if db.Backend != "" && db.Backend != database.BackendMongo {
+		return fmt.Errorf("migrate only applies to the mongo backend, %s migrates itself on startup", db.Backend)
+	}
+
+	client, err := db.ConnectDB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+	defer client.Close(ctx)
+
+	if err := client.WaitReady(ctx); err != nil {
+		return err
+	}
+
+	m := migrations.New(client)
+	switch command {
+	case "", "up":
+		applied, err := m.Up(ctx, *dryRun)
+		for _, mig := range applied {
+			if *dryRun {
+				fmt.Printf("pending  %3d  %s\n", mig.Version, mig.Description)
+			} else {
+				fmt.Printf("applied  %3d  %s\n", mig.Version, mig.Description)
+			}
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			if s.Applied {
+				fmt.Printf("applied  %3d  %s  (%s)\n", s.Version, s.Description, s.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("pending  %3d  %s\n", s.Version, s.Description)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q, use up or status", command)
+}
+
+// migrateOnStartup applies pending MongoDB migrations as soon as the database
+// is reachable. It runs alongside the server so startup never blocks on it.
+// Other backends manage their schema themselves.
+func migrateOnStartup(store database.Store) {
+	client, ok := store.(database.DBClient)
+	if !ok {
+		return
+	}
+	if err := client.WaitReady(context.Background()); err != nil {
+		log.Println("migrations skipped: ", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+	if _, err := migrations.New(client).Up(ctx, false); err != nil {
+		log.Println("migrations failed: ", err)
+	}
+}
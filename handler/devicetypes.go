@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var (
+	ErrDeviceTypeNotFound   = APIError{Code: 404, Message: "device type not found"}
+	ErrDeviceTypeExists     = APIError{Code: 409, Message: "device type already exists"}
+	ErrDeviceTypeInUse      = APIError{Code: 409, Message: "device type still has devices, delete it with cascade=true or reassign=<type>"}
+	ErrDeviceTypeValidation = APIError{Code: 422, Message: "device type breaks validation rules"}
+	ErrDeviceTypeIDMismatch = APIError{Code: 400, Message: "device type id in body does not match the path"}
+	ErrDeleteTypeOptions    = APIError{Code: 400, Message: "cascade and reassign cannot be combined"}
+)
+
+// deviceTypeError maps the errors of the device type store to API errors.
+func deviceTypeError(err error) APIError {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return ErrDeviceTypeNotFound
+	case err.Error() == database.ErrDeviceTypeExists:
+		return ErrDeviceTypeExists
+	case err.Error() == database.ErrDeviceTypeInUse:
+		return ErrDeviceTypeInUse
+	case strings.HasPrefix(err.Error(), database.ErrUnknownDeviceType):
+		return APIError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return DBError(err)
+}
+
+func HandleGetDeviceTypes(w http.ResponseWriter, r *http.Request, mg database.Store) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	types, err := mg.GetDeviceTypesDB(r.Context(), nil)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if types == nil {
+		types = []model.DeviceType{}
+	}
+	HTTPJsonMsg(w, model.DeviceTypes{DeviceTypes: types}, http.StatusOK)
+	return nil
+}
+
+func HandleGetDeviceType(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	types, err := mg.GetDeviceTypesDB(r.Context(), []string{id})
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if len(types) == 0 {
+		HTTPJsonMsg(w, ErrDeviceTypeNotFound, ErrDeviceTypeNotFound.Code)
+		return errors.New(ErrDeviceTypeNotFound.Message)
+	}
+	HTTPJsonMsg(w, types[0], http.StatusOK)
+	return nil
+}
+
+// HandlePostDeviceType creates the device type in the body. Its id may not
+// exist yet, not even with a different case.
+func HandlePostDeviceType(w http.ResponseWriter, r *http.Request, mg database.Store, rules validation.Rules) error {
+	return putDeviceType(w, r, mg, "", rules)
+}
+
+// HandlePutDeviceType creates or replaces the device type with the given id.
+func HandlePutDeviceType(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules) error {
+	return putDeviceType(w, r, mg, id, rules)
+}
+
+// putDeviceType stores the device type in the body. Without id it has to be
+// a new one, otherwise it is stored under id.
+func putDeviceType(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var t model.DeviceType
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if id != "" && t.ID == "" {
+		t.ID = id
+	}
+	if id != "" && t.ID != id {
+		HTTPJsonMsg(w, ErrDeviceTypeIDMismatch, ErrDeviceTypeIDMismatch.Code)
+		return errors.New(ErrDeviceTypeIDMismatch.Message)
+	}
+
+	// A null schema is no schema, others are stored compacted.
+	if string(t.AttributesSchema) == "null" {
+		t.AttributesSchema = nil
+	}
+	if len(t.AttributesSchema) > 0 {
+		var schema bytes.Buffer
+		if err := json.Compact(&schema, t.AttributesSchema); err != nil {
+			HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+			return err
+		}
+		t.AttributesSchema = schema.Bytes()
+	}
+
+	if violations := rules.DeviceType(t); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrDeviceTypeValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	// Types that only differ in case would split the catalog again.
+	types, err := mg.GetDeviceTypesDB(r.Context(), nil)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	for _, existing := range types {
+		if existing.ID != t.ID && strings.EqualFold(existing.ID, t.ID) {
+			msg := withReason(ErrDeviceTypeExists, fmt.Errorf("as %q", existing.ID))
+			HTTPJsonMsg(w, msg, msg.Code)
+			return errors.New(msg.Message)
+		}
+	}
+
+	created, err := mg.PutDeviceTypeDB(r.Context(), t, id == "")
+	if err != nil {
+		msg := deviceTypeError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	code := http.StatusOK
+	if created {
+		w.Header().Set("Location", "/v1/device-types/"+url.PathEscape(t.ID))
+		code = http.StatusCreated
+	}
+	HTTPJsonMsg(w, t, code)
+	return nil
+}
+
+// HandleDeleteDeviceType deletes a device type without devices. With
+// ?cascade=true its devices are deleted too, with ?reassign=<type> they are
+// moved to another type.
+func HandleDeleteDeviceType(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var opts database.DeleteTypeOptions
+	if v := r.URL.Query().Get("cascade"); v != "" {
+		opts.Cascade, err = strconv.ParseBool(v)
+		if err != nil {
+			HTTPJsonMsg(w, ErrInvalidQuery("cascade", v), http.StatusBadRequest)
+			return err
+		}
+	}
+	opts.Reassign = r.URL.Query().Get("reassign")
+	if opts.Cascade && opts.Reassign != "" {
+		HTTPJsonMsg(w, ErrDeleteTypeOptions, ErrDeleteTypeOptions.Code)
+		return errors.New(ErrDeleteTypeOptions.Message)
+	}
+
+	if _, err := mg.DeleteDeviceTypeDB(r.Context(), id, opts); err != nil {
+		msg := deviceTypeError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	return nil
+}
+
+// deviceTypeViolations reports devices that refer to a device type that does
+// not exist and attributes that do not match the attributesSchema of their
+// type. Like the validation rules it only looks at sent fields, see
+// validation.Rules.Device. stored are the stored devices by id in merge
+// mode, nil otherwise. With only one of deviceTypeId and attributes sent, the
+// other one is taken from the stored device. With batch set fields are
+// prefixed like devices[2].deviceTypeId.
+func deviceTypeViolations(ctx context.Context, mg database.Store, devices []model.Device, sent [][]string, stored map[string]model.Device, batch bool) ([]validation.Violation, error) {
+	has := func(i int, field string) bool {
+		return i >= len(sent) || sent[i] == nil || containsFold(sent[i], field)
+	}
+
+	var ids []string
+	checks := make(map[int]model.Device)
+	for i, device := range devices {
+		typeSent, attributesSent := has(i, "deviceTypeId"), has(i, "attributes")
+		if !typeSent && !attributesSent {
+			continue
+		}
+		if s, ok := stored[device.ID]; ok {
+			if !typeSent {
+				device.DeviceTypeID = s.DeviceTypeID
+			}
+			if !attributesSent {
+				device.Attributes = s.Attributes
+			}
+		}
+		if device.DeviceTypeID == "" {
+			continue
+		}
+		checks[i] = device
+		ids = append(ids, device.DeviceTypeID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	types, err := mg.GetDeviceTypesDB(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(types))
+	schemas := make(map[string]*jsonschema.Schema)
+	for _, t := range types {
+		known[t.ID] = true
+		if len(t.AttributesSchema) > 0 {
+			if schemas[t.ID], err = validation.CompileSchema(t.AttributesSchema); err != nil {
+				return nil, fmt.Errorf("attributesSchema of device type %q: %w", t.ID, err)
+			}
+		}
+	}
+
+	var violations []validation.Violation
+	for i := range devices {
+		device, ok := checks[i]
+		if !ok {
+			continue
+		}
+		var found []validation.Violation
+		switch id := device.DeviceTypeID; {
+		case !known[id] && has(i, "deviceTypeId"):
+			found = []validation.Violation{{
+				Field:   "deviceTypeId",
+				Rule:    validation.RuleExists,
+				Message: fmt.Sprintf("device type %q does not exist", id),
+			}}
+		case schemas[id] != nil:
+			found = validation.Attributes(schemas[id], device.Attributes)
+		}
+		for _, v := range found {
+			if batch {
+				v.Field = fmt.Sprintf("devices[%d].%s", i, v.Field)
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
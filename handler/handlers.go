@@ -1,20 +1,33 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
 	"github.com/DerRomtester/testproject-golang-webapi-1/internal/helper"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/lint"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
 	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
 	"github.com/DerRomtester/testproject-golang-webapi-1/model"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
@@ -26,17 +39,84 @@ var (
 	ErrNoCookie             = APIError{Code: 401, Message: "no session cookie"}
 	ErrNoDeviceID           = APIError{Code: 400, Message: "deviceID needs to be specified"}
 	ErrDatabase             = APIError{Code: 500, Message: "db error"}
+	ErrDatabaseTimeout      = APIError{Code: 504, Message: "database did not answer in time"}
+	ErrDatabaseUnavailable  = APIError{Code: 503, Message: "database unavailable"}
 	ErrHashingPW            = APIError{Code: 401, Message: "failed to hash password"}
+	ErrUserExists           = APIError{Code: 409, Message: "user already exists"}
+	ErrDeviceNotFound       = APIError{Code: 404, Message: "device not found"}
+	ErrUnsupportedPatch     = APIError{Code: 415, Message: "patch needs content type " + mergePatchType + " or " + jsonPatchType}
+	ErrInvalidPatch         = APIError{Code: 400, Message: "patch document is invalid"}
+	ErrPatchFailed          = APIError{Code: 409, Message: "patch could not be applied"}
+	ErrInvalidDevice        = APIError{Code: 422, Message: "patched device is invalid"}
+	ErrDeviceValidation     = APIError{Code: 422, Message: "device breaks validation rules"}
+	ErrDeviceIDChanged      = APIError{Code: 422, Message: "device id cannot be changed"}
+	ErrDeviceIDMismatch     = APIError{Code: 400, Message: "device id in body does not match the path"}
+	ErrInvalidExpression    = APIError{Code: 400, Message: "invalid query expression"}
+	ErrNoSearchText         = APIError{Code: 400, Message: "text needs to be specified"}
+	ErrNoSearchPrefix       = APIError{Code: 400, Message: "prefix needs to be specified"}
+	ErrNoDeviceIDs          = APIError{Code: 400, Message: "ids need to be specified"}
+	ErrTooManyDeviceIDs     = APIError{Code: 400, Message: fmt.Sprintf("at most %d ids can be fetched at once", maxBatchGetIDs)}
 )
 
+// Content types accepted by PATCH /v1/device/{id}.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// ErrInvalidQuery reports a query parameter with a value that cannot be used.
+func ErrInvalidQuery(name, value string) APIError {
+	return APIError{Code: 400, Message: fmt.Sprintf("invalid value %q for query parameter %s", value, name)}
+}
+
 type APIError struct {
-	Code    int    `json:"code"`
-	Message string `json:"error"`
+	Code    int           `json:"code"`
+	Message string        `json:"error"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail points at the part of a request an APIError is about.
+type ErrorDetail struct {
+	// Position is the character in a query expression, starting at 1.
+	Position int `json:"position,omitempty"`
+	// Field is the JSON field of a device that breaks Rule.
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every violation in the details of a 422.
+func ValidationError(violations []validation.Violation) APIError {
+	e := ErrDeviceValidation
+	e.Details = make([]ErrorDetail, len(violations))
+	for i, v := range violations {
+		e.Details[i] = ErrorDetail{Field: v.Field, Rule: v.Rule, Message: v.Message}
+	}
+	return e
+}
+
+// withReason returns e with the message of err appended.
+func withReason(e APIError, err error) APIError {
+	e.Message += ": " + err.Error()
+	return e
+}
+
+type HealthStatus struct {
+	Status string `json:"status"`
 }
 
 type ServerConfig struct {
 	Domain string
 	Port   string
+	// MaxPageSize caps the number of devices per page of GET /v1/devices,
+	// zero means query.DefaultMaxPageSize.
+	MaxPageSize int64
+	// Validation limits the devices that can be stored, unset rules use
+	// validation.DefaultRules.
+	Validation validation.Rules
+	// Rules are the catalog rules checked on every device write and by
+	// GET /v1/devices/lint.
+	Rules lint.Rules
 }
 
 type Server struct {
@@ -47,6 +127,21 @@ func (e *APIError) CustomError() error {
 	return fmt.Errorf("%d %s", ErrNotAuthenticated.Code, ErrNotAuthenticated.Message)
 }
 
+// DBError maps an error returned by the storage layer to the API error sent
+// to the client. Exceeded deadlines become 504 and unreachable or canceled
+// backends 503 so they can be told apart from real failures.
+func DBError(err error) APIError {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return ErrDatabaseTimeout
+	case errors.Is(err, context.Canceled), mongo.IsNetworkError(err):
+		return ErrDatabaseUnavailable
+	case err.Error() == database.ErrNotReady, err.Error() == database.ErrNoClient:
+		return ErrDatabaseUnavailable
+	}
+	return ErrDatabase
+}
+
 func (s *ServerConfig) GetHost() *string {
 	return &s.Domain
 }
@@ -55,8 +150,22 @@ func (s *ServerConfig) GetDomain() *string {
 	return &s.Port
 }
 
-func (s *ServerConfig) Run(mg database.DBClient) {
+func (s *ServerConfig) Run(mg database.Store) {
+	log.Println("starting server on host: ", s.Domain, " Port: ", s.Port)
+	http.ListenAndServe(s.Domain+s.Port, s.Routes(mg))
+}
+
+// Routes registers every API endpoint on a new ServeMux backed by mg.
+func (s *ServerConfig) Routes(mg database.Store) *http.ServeMux {
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
+		HTTPJsonMsg(w, HealthStatus{Status: "ok"}, http.StatusOK)
+	})
+
+	mux.HandleFunc("GET /v1/ready", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetReady(w, r, mg)
+	})
+
 	mux.HandleFunc("PUT /v1/auth", func(w http.ResponseWriter, r *http.Request) {
 		HandlePutLogout(w, r, mg)
 	})
@@ -66,11 +175,35 @@ func (s *ServerConfig) Run(mg database.DBClient) {
 	})
 
 	mux.HandleFunc("GET /v1/devices", func(w http.ResponseWriter, r *http.Request) {
-		HandleGetDevices(w, r, mg)
+		HandleGetDevices(w, r, mg, s.MaxPageSize)
+	})
+
+	mux.HandleFunc("GET /v1/devices/search", func(w http.ResponseWriter, r *http.Request) {
+		HandleTextSearchDevices(w, r, mg, s.MaxPageSize)
+	})
+
+	mux.HandleFunc("GET /v1/devices/suggest", func(w http.ResponseWriter, r *http.Request) {
+		HandleSuggestDevices(w, r, mg)
+	})
+
+	mux.HandleFunc("GET /v1/devices/lint", func(w http.ResponseWriter, r *http.Request) {
+		HandleLintDevices(w, r, mg, s.Rules, s.MaxPageSize)
+	})
+
+	mux.HandleFunc("POST /v1/devices/search", func(w http.ResponseWriter, r *http.Request) {
+		HandleSearchDevices(w, r, mg, s.MaxPageSize)
+	})
+
+	mux.HandleFunc("GET /v1/devices:batchGet", func(w http.ResponseWriter, r *http.Request) {
+		HandleBatchGetDevices(w, r, mg)
+	})
+
+	mux.HandleFunc("POST /v1/devices:batchGet", func(w http.ResponseWriter, r *http.Request) {
+		HandleBatchGetDevices(w, r, mg)
 	})
 
 	mux.HandleFunc("POST /v1/devices", func(w http.ResponseWriter, r *http.Request) {
-		HandlePostDevices(w, r, mg)
+		HandlePostDevices(w, r, mg, s.Validation, s.Rules)
 	})
 
 	mux.HandleFunc("DELETE /v1/devices", func(w http.ResponseWriter, r *http.Request) {
@@ -82,11 +215,113 @@ func (s *ServerConfig) Run(mg database.DBClient) {
 		HandleGetDeviceByID(w, r, mg, id)
 	})
 
+	mux.HandleFunc("PUT /v1/device/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		HandlePutDevice(w, r, mg, id, s.Validation, s.Rules)
+	})
+
+	mux.HandleFunc("PATCH /v1/device/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		HandlePatchDevice(w, r, mg, id, s.Validation, s.Rules)
+	})
+
 	mux.HandleFunc("DELETE /v1/device/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		HandleDeleteDevice(w, r, mg, id)
 	})
 
+	mux.HandleFunc("GET /v1/device-types", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetDeviceTypes(w, r, mg)
+	})
+
+	mux.HandleFunc("POST /v1/device-types", func(w http.ResponseWriter, r *http.Request) {
+		HandlePostDeviceType(w, r, mg, s.Validation)
+	})
+
+	mux.HandleFunc("GET /v1/device-types/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetDeviceType(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("PUT /v1/device-types/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandlePutDeviceType(w, r, mg, r.PathValue("id"), s.Validation)
+	})
+
+	mux.HandleFunc("DELETE /v1/device-types/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleDeleteDeviceType(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("GET /v1/projects", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetProjects(w, r, mg)
+	})
+
+	mux.HandleFunc("POST /v1/projects", func(w http.ResponseWriter, r *http.Request) {
+		HandlePostProject(w, r, mg, s.Validation)
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetProject(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("PUT /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandlePutProject(w, r, mg, r.PathValue("id"), s.Validation)
+	})
+
+	mux.HandleFunc("DELETE /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleDeleteProject(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}/view", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetProjectView(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}/cabinets", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetCabinets(w, r, mg, r.PathValue("id"))
+	})
+
+	mux.HandleFunc("POST /v1/projects/{id}/cabinets", func(w http.ResponseWriter, r *http.Request) {
+		HandlePostCabinet(w, r, mg, r.PathValue("id"), s.Validation)
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}/cabinets/{cabinet}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetCabinet(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"))
+	})
+
+	mux.HandleFunc("PUT /v1/projects/{id}/cabinets/{cabinet}", func(w http.ResponseWriter, r *http.Request) {
+		HandlePutCabinet(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"), s.Validation)
+	})
+
+	mux.HandleFunc("DELETE /v1/projects/{id}/cabinets/{cabinet}", func(w http.ResponseWriter, r *http.Request) {
+		HandleDeleteCabinet(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"))
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}/cabinets/{cabinet}/racks", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetRacks(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"))
+	})
+
+	mux.HandleFunc("POST /v1/projects/{id}/cabinets/{cabinet}/racks", func(w http.ResponseWriter, r *http.Request) {
+		HandlePostRack(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"), s.Validation)
+	})
+
+	mux.HandleFunc("GET /v1/projects/{id}/cabinets/{cabinet}/racks/{rack}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetRack(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"), r.PathValue("rack"))
+	})
+
+	mux.HandleFunc("PUT /v1/projects/{id}/cabinets/{cabinet}/racks/{rack}", func(w http.ResponseWriter, r *http.Request) {
+		HandlePutRack(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"), r.PathValue("rack"), s.Validation)
+	})
+
+	mux.HandleFunc("DELETE /v1/projects/{id}/cabinets/{cabinet}/racks/{rack}", func(w http.ResponseWriter, r *http.Request) {
+		HandleDeleteRack(w, r, mg, r.PathValue("id"), r.PathValue("cabinet"), r.PathValue("rack"))
+	})
+
+	mux.HandleFunc("POST /v1/planning/environment", func(w http.ResponseWriter, r *http.Request) {
+		HandlePlanEnvironment(w, r, mg, s.Validation, s.MaxPageSize)
+	})
+
+	mux.HandleFunc("POST /v1/planning/motion", func(w http.ResponseWriter, r *http.Request) {
+		HandlePlanMotion(w, r, mg, s.Validation)
+	})
+
 	mux.HandleFunc("GET /v1/session", func(w http.ResponseWriter, r *http.Request) {
 		HandleGetSession(w, r, mg)
 	})
@@ -99,8 +334,19 @@ func (s *ServerConfig) Run(mg database.DBClient) {
 		HandleCreateUser(w, r, mg)
 	})
 
-	log.Println("starting server on host: ", s.Domain, " Port: ", s.Port)
-	http.ListenAndServe(s.Domain+s.Port, mux)
+	return mux
+}
+
+// HandleGetReady reports whether the server can reach its database. Load
+// balancers should only route traffic to replicas that answer 200 here.
+func HandleGetReady(w http.ResponseWriter, r *http.Request, mg database.Store) error {
+	if err := mg.ClientStatusDB(); err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	HTTPJsonMsg(w, HealthStatus{Status: "ready"}, http.StatusOK)
+	return nil
 }
 
 func CheckAuthValidJson(r *http.Request) (model.UserCredentials, APIError, error) {
@@ -115,7 +361,7 @@ func CheckAuthValidJson(r *http.Request) (model.UserCredentials, APIError, error
 	return creds, msg, nil
 }
 
-func HandleCreateUser(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandleCreateUser(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	creds, msg, err := CheckAuthValidJson(r)
 	if err != nil {
 		HTTPJsonMsg(w, msg, http.StatusBadRequest)
@@ -123,19 +369,25 @@ func HandleCreateUser(w http.ResponseWriter, r *http.Request, mg database.DBClie
 	}
 
 	if err := mg.ClientStatusDB(); err != nil {
-		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
-	if err := mg.CreateUserDB(creds); err != nil {
-		HTTPJsonMsg(w, err.Error(), http.StatusInternalServerError)
+	if err := mg.CreateUserDB(r.Context(), creds); err != nil {
+		if err.Error() == database.ErrUserExists {
+			HTTPJsonMsg(w, ErrUserExists, http.StatusConflict)
+			return err
+		}
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 	return nil
 }
 
-func CheckUserPassword(u model.UserCredentials, mg database.DBClient) error {
-	db, err := mg.GetUserDB(u.Username)
+func CheckUserPassword(ctx context.Context, u model.UserCredentials, mg database.UserStore) error {
+	db, err := mg.GetUserDB(ctx, u.Username)
 	if err != nil {
 		return err
 	}
@@ -149,7 +401,7 @@ func CheckUserPassword(u model.UserCredentials, mg database.DBClient) error {
 	return nil
 }
 
-func HandlePostLogin(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandlePostLogin(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -167,7 +419,7 @@ func HandlePostLogin(w http.ResponseWriter, r *http.Request, mg database.DBClien
 		return err
 	}
 
-	err = CheckUserPassword(creds, mg)
+	err = CheckUserPassword(r.Context(), creds, mg)
 	if err != nil {
 		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
 		return ErrNotAuthenticated.CustomError()
@@ -182,10 +434,11 @@ func HandlePostLogin(w http.ResponseWriter, r *http.Request, mg database.DBClien
 		Token:    sessionToken,
 	}
 
-	err = mg.CreateSessionDB(session)
+	err = mg.CreateSessionDB(r.Context(), session)
 	if err != nil {
-		HTTPJsonMsg(w, ErrDatabase, http.StatusInternalServerError)
-		return ErrDatabase.CustomError()
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
 	}
 
 	http.SetCookie(w, &http.Cookie{
@@ -197,7 +450,7 @@ func HandlePostLogin(w http.ResponseWriter, r *http.Request, mg database.DBClien
 	return nil
 }
 
-func CheckAuth(r *http.Request, mg database.DBClient) (APIError, error) {
+func CheckAuth(r *http.Request, mg database.SessionStore) (APIError, error) {
 	c, err := r.Cookie("session_token")
 	if err != nil {
 		if err == http.ErrNoCookie {
@@ -206,22 +459,25 @@ func CheckAuth(r *http.Request, mg database.DBClient) (APIError, error) {
 		return ErrNoCookie, err
 	}
 	sessionToken := c.Value
-	existingToken, err := mg.GetTokenDB(sessionToken)
-	if err != nil {
+	existingToken, err := mg.GetTokenDB(r.Context(), sessionToken)
+	if errors.Is(err, database.ErrNotFound) {
 		return ErrSessionNotExist, ErrSessionNotExist.CustomError()
 	}
+	if err != nil {
+		return DBError(err), err
+	}
 
 	if existingToken.IsExpired() {
-		err = mg.DeleteTokenDB(*existingToken.GetToken())
+		err = mg.DeleteTokenDB(r.Context(), *existingToken.GetToken())
 		if err != nil {
-			return ErrDatabase, ErrDatabase.CustomError()
+			return DBError(err), err
 		}
 		return ErrSessionExpired, ErrSessionNotExist.CustomError()
 	}
 	return APIError{}, nil
 }
 
-func HandleGetSession(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandleGetSession(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	c, err := r.Cookie("session_token")
 	if err != nil {
 		if err == http.ErrNoCookie {
@@ -232,14 +488,19 @@ func HandleGetSession(w http.ResponseWriter, r *http.Request, mg database.DBClie
 		return err
 	}
 	sessionToken := c.Value
-	userSession, err := mg.GetTokenDB(sessionToken)
-	if err != nil {
+	userSession, err := mg.GetTokenDB(r.Context(), sessionToken)
+	if errors.Is(err, database.ErrNotFound) {
 		HTTPJsonMsg(w, ErrSessionNotExist, http.StatusUnauthorized)
 		return err
 	}
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
 
 	if userSession.IsExpired() {
-		mg.DeleteTokenDB(sessionToken)
+		mg.DeleteTokenDB(r.Context(), sessionToken)
 		HTTPJsonMsg(w, ErrSessionExpired, http.StatusUnauthorized)
 		return err
 	}
@@ -248,7 +509,7 @@ func HandleGetSession(w http.ResponseWriter, r *http.Request, mg database.DBClie
 	return nil
 }
 
-func HandlePutRefreshToken(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandlePutRefreshToken(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	c, err := r.Cookie("session_token")
 	if err != nil {
 		if err == http.ErrNoCookie {
@@ -260,25 +521,32 @@ func HandlePutRefreshToken(w http.ResponseWriter, r *http.Request, mg database.D
 	}
 	sessionToken := c.Value
 
-	userSession, err := mg.GetTokenDB(sessionToken)
-	if err != nil {
+	userSession, err := mg.GetTokenDB(r.Context(), sessionToken)
+	if errors.Is(err, database.ErrNotFound) {
 		HTTPJsonMsg(w, ErrSessionNotExist, http.StatusUnauthorized)
 		return err
 	}
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
 
 	if userSession.IsExpired() {
-		mg.DeleteTokenDB(sessionToken)
+		mg.DeleteTokenDB(r.Context(), sessionToken)
 		HTTPJsonMsg(w, ErrSessionExpired, http.StatusUnauthorized)
 		return err
 	}
 
 	newSession := userSession.RenewSession(120)
-	err = mg.CreateSessionDB(newSession)
+	err = mg.CreateSessionDB(r.Context(), newSession)
 	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
-	mg.DeleteTokenDB(sessionToken)
+	mg.DeleteTokenDB(r.Context(), sessionToken)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:    "session_token",
@@ -288,7 +556,7 @@ func HandlePutRefreshToken(w http.ResponseWriter, r *http.Request, mg database.D
 	return nil
 }
 
-func HandlePutLogout(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandlePutLogout(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -310,9 +578,10 @@ func HandlePutLogout(w http.ResponseWriter, r *http.Request, mg database.DBClien
 		return err
 	}
 
-	err = mg.DeleteTokenDB(sessionToken)
+	err = mg.DeleteTokenDB(r.Context(), sessionToken)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
@@ -330,52 +599,306 @@ func HandlePutLogout(w http.ResponseWriter, r *http.Request, mg database.DBClien
 	return nil
 }
 
-func HandleGetDevices(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+// HandleGetDevices lists the devices one page at a time, filtered and sorted
+// as described by the query parameters, see query.Parse. The cursor of the
+// next page is returned in the body and in a Link header.
+func HandleGetDevices(w http.ResponseWriter, r *http.Request, mg database.Store, maxPageSize int64) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	return listDevices(w, r, mg, r.URL.Query(), maxPageSize)
+}
+
+// maxSearchBytes limits the body of a device search. It holds a query
+// expression of at most query.MaxExprLength characters and a few short
+// parameters.
+const maxSearchBytes = 64 << 10
+
+// HandleSearchDevices is HandleGetDevices with the expression, sort, limit
+// and cursor in a model.DeviceSearch body, for expressions too long for a
+// URL. Query parameters are still read as filters.
+func HandleSearchDevices(w http.ResponseWriter, r *http.Request, mg database.Store, maxPageSize int64) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var search model.DeviceSearch
+	r.Body = http.MaxBytesReader(w, r.Body, maxSearchBytes)
+	if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+
+	values := r.URL.Query()
+	for key, v := range map[string]string{"q": search.Query, "sort": search.Sort, "cursor": search.Cursor, "fields": search.Fields} {
+		if v != "" {
+			values.Set(key, v)
+		}
+	}
+	if search.Limit != 0 {
+		values.Set("limit", strconv.FormatInt(search.Limit, 10))
+	}
+	return listDevices(w, r, mg, values, maxPageSize)
+}
+
+// Number of results of a text search and of name suggestions without limit.
+const (
+	defaultSearchResults = 20
+	defaultSuggestions   = 10
+)
+
+// HandleTextSearchDevices finds devices by the words in their name and
+// device type, best matches first.
+func HandleTextSearchDevices(w http.ResponseWriter, r *http.Request, mg database.Store, maxPageSize int64) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	msg, err := CheckAuth(r, mg)
 	if err != nil {
-		HTTPJsonMsg(w, msg, http.StatusUnauthorized)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
 	err = mg.ClientStatusDB()
 	if err != nil {
-		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
-		return ErrNotAuthenticated.CustomError()
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
 	}
 
-	var devices model.Devices
-	devices, err = mg.GetDeviceDB(bson.D{{}})
+	text := r.URL.Query().Get("text")
+	if strings.TrimSpace(text) == "" {
+		HTTPJsonMsg(w, ErrNoSearchText, ErrNoSearchText.Code)
+		return errors.New(ErrNoSearchText.Message)
+	}
+	limit, err := query.ParseLimit(r.URL.Query().Get("limit"), defaultSearchResults, maxPageSize)
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := QueryError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
-	alldevices, err := json.Marshal(devices)
+
+	matches, err := mg.SearchDevicesDB(r.Context(), text, limit)
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
-	w.Write(alldevices)
+	HTTPJsonMsg(w, model.DeviceMatches{Matches: matches}, http.StatusOK)
 	return nil
 }
 
-func HandleGetDeviceByID(w http.ResponseWriter, r *http.Request, mg database.DBClient, id string) error {
+// HandleSuggestDevices completes a device name from its first characters.
+func HandleSuggestDevices(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	msg, err := CheckAuth(r, mg)
 	if err != nil {
-		HTTPJsonMsg(w, msg, http.StatusUnauthorized)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		HTTPJsonMsg(w, ErrNoSearchPrefix, ErrNoSearchPrefix.Code)
+		return errors.New(ErrNoSearchPrefix.Message)
+	}
+	limit, err := query.ParseLimit(r.URL.Query().Get("limit"), defaultSuggestions, 0)
+	if err != nil {
+		msg := QueryError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	names, err := mg.SuggestDeviceNamesDB(r.Context(), prefix, limit)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	HTTPJsonMsg(w, model.DeviceSuggestions{Suggestions: names}, http.StatusOK)
+	return nil
+}
+
+// listDevices answers with the page of devices described by values.
+func listDevices(w http.ResponseWriter, r *http.Request, mg database.Store, values url.Values, maxPageSize int64) error {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	q, err := query.Parse(values, maxPageSize)
+	if err != nil {
+		msg := QueryError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	devices, err := mg.GetDeviceDB(r.Context(), q.FindFilter(), q.FindOptions())
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var result model.DevicePage
+	var next *query.Cursor
+	result.Devices, next = q.Next(devices.Devices)
+	if next != nil {
+		result.Next = next.Encode()
+		// Links can only be followed with GET.
+		if r.Method == http.MethodGet {
+			w.Header().Set("Link", pageLink(r, result.Next, "next"))
+		}
+	}
+	if q.Fields != nil {
+		partial := model.PartialDevicePage{Devices: make([]model.PartialDevice, len(result.Devices)), Next: result.Next}
+		for i, device := range result.Devices {
+			partial.Devices[i] = q.Fields.Select(device)
+		}
+		HTTPJsonMsg(w, partial, http.StatusOK)
+		return nil
+	}
+	HTTPJsonMsg(w, result, http.StatusOK)
+	return nil
+}
+
+// QueryError maps an invalid list query to a 400. Expression errors carry
+// their position in the details.
+func QueryError(err error) APIError {
+	var exprErr *query.ExprError
+	if errors.As(err, &exprErr) {
+		return APIError{
+			Code:    http.StatusBadRequest,
+			Message: ErrInvalidExpression.Message,
+			Details: []ErrorDetail{{Position: exprErr.Pos, Message: exprErr.Msg}},
+		}
+	}
+	return APIError{Code: http.StatusBadRequest, Message: err.Error()}
+}
+
+// pageLink returns an RFC 8288 link to the same list starting at cursor.
+func pageLink(r *http.Request, cursor, rel string) string {
+	values := r.URL.Query()
+	values.Set("cursor", cursor)
+	link := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
+
+// maxBatchGetIDs caps the ids of a single batch get.
+const maxBatchGetIDs = 1000
+
+// HandleBatchGetDevices fetches the devices with the ids in the body of a POST
+// or the repeated id parameters of a GET with one query. Devices come back in
+// the order of the ids, ids without device are listed as missing.
+func HandleBatchGetDevices(w http.ResponseWriter, r *http.Request, mg database.Store) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var batch model.DeviceBatchGet
+	if r.Method == http.MethodGet {
+		batch.IDs = r.URL.Query()["id"]
+	} else if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+
+	ids := uniqueIDs(batch.IDs)
+	switch {
+	case len(ids) == 0:
+		HTTPJsonMsg(w, ErrNoDeviceIDs, ErrNoDeviceIDs.Code)
+		return errors.New(ErrNoDeviceIDs.Message)
+	case len(ids) > maxBatchGetIDs:
+		HTTPJsonMsg(w, ErrTooManyDeviceIDs, ErrTooManyDeviceIDs.Code)
+		return errors.New(ErrTooManyDeviceIDs.Message)
+	}
+
+	devices, err := mg.GetDeviceDB(r.Context(), primitive.D{{Key: "_id", Value: primitive.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	found := make(map[string]model.Device, len(devices.Devices))
+	for _, device := range devices.Devices {
+		found[device.ID] = device
+	}
+	result := model.DeviceBatch{Devices: []model.Device{}, Missing: []string{}}
+	for _, id := range ids {
+		if device, ok := found[id]; ok {
+			result.Devices = append(result.Devices, device)
+		} else {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+	HTTPJsonMsg(w, result, http.StatusOK)
+	return nil
+}
+
+// uniqueIDs returns the non-empty ids in their order without repetitions.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func HandleGetDeviceByID(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
 		return nil
 	}
 
 	var devices model.Devices
 	err = mg.ClientStatusDB()
 	if err != nil {
-		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
-		return ErrNotAuthenticated.CustomError()
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
 	}
 
 	if id == "" {
@@ -383,34 +906,239 @@ func HandleGetDeviceByID(w http.ResponseWriter, r *http.Request, mg database.DBC
 		return ErrNoDeviceID.CustomError()
 	}
 
-	devices, err = mg.GetDeviceDB(primitive.D{{Key: "_id", Value: id}})
+	fields, err := query.ParseProjection(r.URL.Query().Get("fields"))
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := QueryError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
-	singledevice, err := json.Marshal(devices)
+
+	devices, err = mg.GetDeviceDB(r.Context(), primitive.D{{Key: "_id", Value: id}}, database.FindOptions{Projection: fields.Keys()})
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
-	w.Write(singledevice)
+	if len(devices.Devices) == 0 {
+		HTTPJsonMsg(w, ErrDeviceNotFound, ErrDeviceNotFound.Code)
+		return errors.New(ErrDeviceNotFound.Message)
+	}
+	if fields != nil {
+		HTTPJsonMsg(w, fields.Select(devices.Devices[0]), http.StatusOK)
+		return nil
+	}
+	HTTPJsonMsg(w, devices.Devices[0], http.StatusOK)
 	return nil
 }
 
-func HandleDeleteDevice(w http.ResponseWriter, r *http.Request, mg database.DBClient, id string) error {
+// HandlePutDevice stores the body as the device with the given id, replacing
+// every field. New devices answer 201 with their Location.
+func HandlePutDevice(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules, catalog lint.Rules) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	msg, err := CheckAuth(r, mg)
 	if err != nil {
-		HTTPJsonMsg(w, msg, http.StatusUnauthorized)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return nil
 	}
 
 	err = mg.ClientStatusDB()
 	if err != nil {
-		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
-		return ErrNotAuthenticated.CustomError()
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var device model.Device
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if device.ID == "" {
+		device.ID = id
+	}
+	if device.ID != id {
+		HTTPJsonMsg(w, ErrDeviceIDMismatch, ErrDeviceIDMismatch.Code)
+		return errors.New(ErrDeviceIDMismatch.Message)
+	}
+	violations := rules.Device(device, nil)
+	unknownTypes, err := deviceTypeViolations(r.Context(), mg, []model.Device{device}, nil, nil, false)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	findings, err := ruleFindings(catalog, []model.Device{device})
+	if err != nil {
+		msg := ruleError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	violations = append(violations, unknownTypes...)
+	if violations = append(violations, ruleViolations(findings, false)...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	results, err := mg.WriteDevicesDB(r.Context(), model.Devices{Devices: []model.Device{device}},
+		database.WriteOptions{Mode: model.WriteModeReplace})
+	if err == nil && results[0].Status == model.WriteFailed {
+		err = errors.New(results[0].Reason)
+	}
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	code := http.StatusOK
+	if results[0].Status == model.WriteCreated {
+		w.Header().Set("Location", "/v1/device/"+url.PathEscape(id))
+		code = http.StatusCreated
+	}
+	setRuleWarnings(w, findings)
+	HTTPJsonMsg(w, device, code)
+	return nil
+}
+
+// HandlePatchDevice applies a JSON Merge Patch (RFC 7396) or JSON Patch
+// (RFC 6902) to the device and answers with the patched device.
+func HandlePatchDevice(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules, catalog lint.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return nil
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		HTTPJsonMsg(w, ErrUnsupportedPatch, ErrUnsupportedPatch.Code)
+		return errors.New(ErrUnsupportedPatch.Message)
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+
+	devices, err := mg.GetDeviceDB(r.Context(), primitive.D{{Key: "_id", Value: id}}, database.FindOptions{})
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if len(devices.Devices) == 0 {
+		HTTPJsonMsg(w, ErrDeviceNotFound, ErrDeviceNotFound.Code)
+		return errors.New(ErrDeviceNotFound.Message)
+	}
+
+	device, msg, err := patchDevice(devices.Devices[0], mediaType, patch)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	violations := rules.Device(device, nil)
+	unknownTypes, err := deviceTypeViolations(r.Context(), mg, []model.Device{device}, nil, nil, false)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	findings, err := ruleFindings(catalog, []model.Device{device})
+	if err != nil {
+		msg := ruleError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	violations = append(violations, unknownTypes...)
+	if violations = append(violations, ruleViolations(findings, false)...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	results, err := mg.WriteDevicesDB(r.Context(), model.Devices{Devices: []model.Device{device}},
+		database.WriteOptions{Mode: model.WriteModeReplace})
+	if err == nil && results[0].Status == model.WriteFailed {
+		err = errors.New(results[0].Reason)
+	}
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	setRuleWarnings(w, findings)
+	HTTPJsonMsg(w, device, http.StatusOK)
+	return nil
+}
+
+// patchDevice applies patch of the given media type to device. The result has
+// to decode into a model.Device without unknown fields and keep its ID.
+func patchDevice(device model.Device, mediaType string, patch []byte) (model.Device, APIError, error) {
+	doc, err := json.Marshal(device)
+	if err != nil {
+		return device, ErrDatabase, err
+	}
+
+	var patched []byte
+	switch mediaType {
+	case mergePatchType:
+		patched, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return device, withReason(ErrInvalidPatch, err), err
+		}
+	case jsonPatchType:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return device, withReason(ErrInvalidPatch, err), err
+		}
+		patched, err = ops.Apply(doc)
+		if err != nil {
+			return device, withReason(ErrPatchFailed, err), err
+		}
+	}
+
+	var result model.Device
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return device, withReason(ErrInvalidDevice, err), err
+	}
+	if result.ID != device.ID {
+		return device, ErrDeviceIDChanged, errors.New(ErrDeviceIDChanged.Message)
+	}
+	return result, APIError{}, nil
+}
+
+func HandleDeleteDevice(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return nil
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
 	}
 
 	if id == "" {
@@ -418,69 +1146,221 @@ func HandleDeleteDevice(w http.ResponseWriter, r *http.Request, mg database.DBCl
 		return ErrNoDeviceID.CustomError()
 	}
 
-	err = mg.DeleteDeviceDB(primitive.D{{Key: "_id", Value: id}}, false)
+	deleted, err := mg.DeleteDeviceDB(r.Context(), primitive.D{{Key: "_id", Value: id}}, false)
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
+	if deleted == 0 {
+		HTTPJsonMsg(w, ErrDeviceNotFound, ErrDeviceNotFound.Code)
+		return errors.New(ErrDeviceNotFound.Message)
+	}
 	return nil
 }
 
-func HandleDeleteDevices(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+func HandleDeleteDevices(w http.ResponseWriter, r *http.Request, mg database.Store) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	msg, err := CheckAuth(r, mg)
 	if err != nil {
-		HTTPJsonMsg(w, msg, http.StatusUnauthorized)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
 	err = mg.ClientStatusDB()
 	if err != nil {
-		HTTPJsonMsg(w, ErrNotAuthenticated, http.StatusUnauthorized)
-		return ErrNotAuthenticated.CustomError()
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
 	}
 
-	err = mg.DeleteDeviceDB(bson.D{{}}, true)
+	_, err = mg.DeleteDeviceDB(r.Context(), bson.D{{}}, true)
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 	return nil
 }
 
-func HandlePostDevices(w http.ResponseWriter, r *http.Request, mg database.DBClient) error {
+// decodeDevices decodes a model.Devices body and returns for every device
+// the JSON fields that were sent, so merges can tell a missing field from a
+// zero value.
+func decodeDevices(r *http.Request) (model.Devices, [][]string, error) {
+	var body struct {
+		Devices []json.RawMessage `json:"devices"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return model.Devices{}, nil, err
+	}
+
+	devices := model.Devices{Devices: make([]model.Device, len(body.Devices))}
+	fields := make([][]string, len(body.Devices))
+	for i, raw := range body.Devices {
+		if err := json.Unmarshal(raw, &devices.Devices[i]); err != nil {
+			return model.Devices{}, nil, err
+		}
+		var sent map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &sent); err != nil {
+			return model.Devices{}, nil, err
+		}
+		fields[i] = make([]string, 0, len(sent))
+		for name := range sent {
+			fields[i] = append(fields[i], name)
+		}
+	}
+	return devices, fields, nil
+}
+
+func HandlePostDevices(w http.ResponseWriter, r *http.Request, mg database.Store, rules validation.Rules, catalog lint.Rules) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	var devices model.Devices
 
 	msg, err := CheckAuth(r, mg)
 	if err != nil {
-		HTTPJsonMsg(w, msg, http.StatusUnauthorized)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return nil
 	}
 
 	err = mg.ClientStatusDB()
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusUnauthorized)
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&devices)
+	var opts database.WriteOptions
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", model.WriteModeMerge, model.WriteModeReplace, model.WriteModeCreate:
+		opts.Mode = mode
+	default:
+		msg := ErrInvalidQuery("mode", mode)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+	if v := r.URL.Query().Get("atomic"); v != "" {
+		opts.Atomic, err = strconv.ParseBool(v)
+		if err != nil {
+			HTTPJsonMsg(w, ErrInvalidQuery("atomic", v), http.StatusBadRequest)
+			return err
+		}
+	}
 
+	devices, fields, err := decodeDevices(r)
+	if err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	opts.Fields = fields
+
+	// Stored devices are checked as a whole after merging, so the sent fields
+	// have to fit the kept ones. Otherwise only the sent fields are checked,
+	// the others are empty.
+	checked, checkedFields := devices.Devices, fields
+	var stored map[string]model.Device
+	if opts.Mode == "" || opts.Mode == model.WriteModeMerge {
+		stored, err = storedDevices(r.Context(), mg, devices.Devices)
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		checked, checkedFields = mergeStored(devices.Devices, fields, stored)
+	}
+	violations := rules.Devices(checked, checkedFields)
+	unknownTypes, err := deviceTypeViolations(r.Context(), mg, devices.Devices, fields, stored, true)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	findings, err := ruleFindings(catalog, checked)
 	if err != nil {
-		HTTPJsonMsg(w, err, http.StatusBadRequest)
+		msg := ruleError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
 		return err
 	}
+	violations = append(violations, unknownTypes...)
+	if violations = append(violations, ruleViolations(findings, true)...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
 
-	if err := mg.WriteDevicesDB(devices); err != nil {
-		HTTPJsonMsg(w, err, http.StatusInternalServerError)
-		return nil
+	results, err := mg.WriteDevicesDB(r.Context(), devices, opts)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	for i := range findings {
+		if status := results[i].Status; status != model.WriteFailed && status != model.WriteConflict {
+			results[i].Warnings = lint.WithSeverity(findings[i], model.SeverityWarning)
+		}
+	}
+
+	// Some devices failed: 207 tells the client to look at the single results.
+	// Conflicts in create mode take precedence with 409.
+	code := http.StatusOK
+	for _, result := range results {
+		switch result.Status {
+		case model.WriteConflict:
+			code = http.StatusConflict
+		case model.WriteFailed:
+			if code == http.StatusOK {
+				code = http.StatusMultiStatus
+			}
+		}
 	}
+	HTTPJsonMsg(w, model.DeviceWriteResults{Results: results}, code)
 	return nil
 }
 
+// storedDevices returns the stored devices among devices by id.
+func storedDevices(ctx context.Context, mg database.Store, devices []model.Device) (map[string]model.Device, error) {
+	var ids []string
+	for _, device := range devices {
+		if device.ID != "" {
+			ids = append(ids, device.ID)
+		}
+	}
+	stored := make(map[string]model.Device, len(ids))
+	if len(ids) == 0 {
+		return stored, nil
+	}
+	found, err := mg.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range found.Devices {
+		stored[device.ID] = device
+	}
+	return stored, nil
+}
+
+// mergeStored returns devices as merge mode will store them: the sent fields
+// of every device in stored are merged into its stored copy. The returned
+// fields are the ones to validate, all of them (nil) for merged devices and
+// the sent ones for new devices. sent is indexed like devices and may be nil.
+func mergeStored(devices []model.Device, sent [][]string, stored map[string]model.Device) ([]model.Device, [][]string) {
+	merged := make([]model.Device, len(devices))
+	checked := make([][]string, len(devices))
+	for i, device := range devices {
+		var fields []string
+		if i < len(sent) {
+			fields = sent[i]
+		}
+		if s, ok := stored[device.ID]; ok {
+			device, fields = database.MergeDevice(s, device, fields), nil
+		}
+		merged[i], checked[i] = device, fields
+	}
+	return merged, checked
+}
+
 func HTTPJsonMsg(w http.ResponseWriter, err interface{}, code int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -2,15 +2,97 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/DerRomtester/testproject-golang-webapi-1/handler"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/lint"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
 	"github.com/DerRomtester/testproject-golang-webapi-1/model"
 )
 
+var testCreds = model.UserCredentials{
+	Username: "test_user",
+	Password: "password123",
+}
+
+// newTestServer starts the API on an in-memory store and returns a client
+// that is already logged in.
+func newTestServer(t *testing.T) (*httptest.Server, *http.Client, *database.MemoryStore) {
+	t.Helper()
+	store := database.NewMemoryStore()
+	srv := handler.ServerConfig{}
+	ts := httptest.NewServer(srv.Routes(store))
+	t.Cleanup(ts.Close)
+
+	return ts, login(t, ts), store
+}
+
+// login creates the test user on ts and returns a client with its session.
+func login(t *testing.T, ts *httptest.Server) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/user", testCreds)
+	res.Body.Close()
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/auth", testCreds)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("login failed with status %d", res.StatusCode)
+	}
+	return client
+}
+
+func doJSON(t *testing.T, client *http.Client, method, url string, body interface{}) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// addDeviceTypes registers device types with the given ids in store.
+func addDeviceTypes(t *testing.T, store database.Store, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if _, err := store.PutDeviceTypeDB(context.Background(), model.DeviceType{ID: id, Name: id}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func decodeBody(t *testing.T, res *http.Response, v interface{}) {
+	t.Helper()
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestCheckAuthValidJson_Success(t *testing.T) {
 	validCreds := model.UserCredentials{
 		Username: "test_user",
@@ -61,3 +143,954 @@ func TestCheckAuthValidJson_EmptyBody(t *testing.T) {
 		t.Error("Expected error for emtpty request body")
 	}
 }
+
+func TestDevicesNotAuthenticated(t *testing.T) {
+	ts := httptest.NewServer((&handler.ServerConfig{}).Routes(database.NewMemoryStore()))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/v1/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got: %d", http.StatusUnauthorized, res.StatusCode)
+	}
+}
+
+func TestDevicesRoundTrip(t *testing.T) {
+	ts, client, store := newTestServer(t)
+	addDeviceTypes(t, store, "cpu", "io")
+
+	devices := model.Devices{Devices: []model.Device{
+		{ID: "1glmLrTZqf9YZleN", Name: "S7-1500", DeviceTypeID: "cpu", TempMax: 60},
+		{ID: "2glmLrTZqf9YZleN", Name: "ET 200SP", DeviceTypeID: "io", TempMax: 55},
+	}}
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", devices)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+	var written model.DeviceWriteResults
+	decodeBody(t, res, &written)
+	if len(written.Results) != 2 || written.Results[0].Status != model.WriteCreated {
+		t.Errorf("Expected 2 created devices, got: %v", written.Results)
+	}
+
+	renamed := model.Devices{Devices: []model.Device{devices.Devices[0], {ID: "2glmLrTZqf9YZleN", Name: "ET 200MP"}}}
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices?atomic=true", renamed), &written)
+	if written.Results[0].Status != model.WriteUnchanged || written.Results[1].Status != model.WriteUpdated {
+		t.Errorf("Expected unchanged and updated, got: %v", written.Results)
+	}
+
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices?atomic=maybe", devices)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid atomic, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var got model.Devices
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices", nil), &got)
+	if len(got.Devices) != 2 {
+		t.Fatalf("Expected 2 devices, got: %v", got.Devices)
+	}
+
+	var single model.Device
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/2glmLrTZqf9YZleN", nil), &single)
+	if single.Name != "ET 200MP" {
+		t.Errorf("Expected device ET 200MP, got: %v", single)
+	}
+
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/device/2glmLrTZqf9YZleN", nil)
+	res.Body.Close()
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices", nil), &got)
+	if len(got.Devices) != 1 {
+		t.Errorf("Expected 1 device after delete, got: %v", got.Devices)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		var msg handler.APIError
+		res = doJSON(t, client, method, ts.URL+"/v1/device/2glmLrTZqf9YZleN", nil)
+		decodeBody(t, res, &msg)
+		if res.StatusCode != http.StatusNotFound || msg.Message != handler.ErrDeviceNotFound.Message {
+			t.Errorf("Expected %v for %s of a deleted device, got: %d %v", handler.ErrDeviceNotFound, method, res.StatusCode, msg)
+		}
+	}
+}
+
+func TestGetDevicesPages(t *testing.T) {
+	store := database.NewMemoryStore()
+	srv := handler.ServerConfig{MaxPageSize: 2}
+	ts := httptest.NewServer(srv.Routes(store))
+	t.Cleanup(ts.Close)
+	client := login(t, ts)
+
+	var devices model.Devices
+	for _, id := range []string{"e", "d", "c", "b", "a"} {
+		devices.Devices = append(devices.Devices, model.Device{ID: id, Name: "device " + id})
+	}
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", devices)
+	res.Body.Close()
+
+	var ids []string
+	next := ts.URL + "/v1/devices?limit=10"
+	for pages := 0; next != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("Expected 3 pages, got more: %v", ids)
+		}
+		var page model.DevicePage
+		res := doJSON(t, client, http.MethodGet, next, nil)
+		link := res.Header.Get("Link")
+		decodeBody(t, res, &page)
+		for _, device := range page.Devices {
+			ids = append(ids, device.ID)
+		}
+
+		next = ""
+		if page.Next != "" {
+			next = ts.URL + "/v1/devices?limit=10&cursor=" + page.Next
+			want := `</v1/devices?cursor=` + page.Next + `&limit=10>; rel="next"`
+			if link != want {
+				t.Errorf("Expected Link %s, got: %s", want, link)
+			}
+		} else if link != "" {
+			t.Errorf("Expected no Link on the last page, got: %s", link)
+		}
+	}
+	if strings.Join(ids, "") != "abcde" {
+		t.Errorf("Expected devices a to e in order, got: %v", ids)
+	}
+
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices?cursor=bogus", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid cursor, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestGetDevicesFilterAndSort(t *testing.T) {
+	store := database.NewMemoryStore()
+	srv := handler.ServerConfig{MaxPageSize: 1}
+	ts := httptest.NewServer(srv.Routes(store))
+	t.Cleanup(ts.Close)
+	client := login(t, ts)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", Failsafe: true, TempMax: 60, InstallationPosition: "horizontal", SiplusCatalog: true},
+		{ID: "b", Name: "S7-1200", Failsafe: true, TempMax: 70, InstallationPosition: "horizontal", SiplusCatalog: true},
+		{ID: "c", Name: "ET 200SP", Failsafe: true, TempMax: 70, InstallationPosition: "horizontal", SiplusCatalog: true},
+		{ID: "d", Name: "S7-1500", Failsafe: false, TempMax: 70, InstallationPosition: "horizontal", SiplusCatalog: true},
+		{ID: "e", Name: "S7-1500", Failsafe: true, TempMax: 50, InstallationPosition: "horizontal", SiplusCatalog: true},
+		{ID: "f", Name: "S7-1500", Failsafe: true, TempMax: 70, InstallationPosition: "vertical", SiplusCatalog: true},
+	}})
+	res.Body.Close()
+
+	var ids []string
+	next := ts.URL + "/v1/devices?failsafe=true&tempMax.gte=60&installationPosition=horizontal&siplusCatalog=true&sort=-tempMax,name"
+	for next != "" {
+		var page model.DevicePage
+		decodeBody(t, doJSON(t, client, http.MethodGet, next, nil), &page)
+		for _, device := range page.Devices {
+			ids = append(ids, device.ID)
+		}
+		next = ""
+		if page.Next != "" {
+			next = ts.URL + "/v1/devices?failsafe=true&tempMax.gte=60&installationPosition=horizontal&siplusCatalog=true&sort=-tempMax,name&cursor=" + page.Next
+		}
+	}
+	if strings.Join(ids, "") != "cba" {
+		t.Errorf("Expected devices c, b, a, got: %v", ids)
+	}
+
+	for _, q := range []string{"color=red", "tempMax=hot", "name.gt=a", "sort=color"} {
+		var msg handler.APIError
+		res := doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices?"+q, nil)
+		decodeBody(t, res, &msg)
+		if res.StatusCode != http.StatusBadRequest || msg.Message == "" {
+			t.Errorf("Expected status %d with a message for %s, got: %d %v", http.StatusBadRequest, q, res.StatusCode, msg)
+		}
+	}
+}
+
+func TestGetDevicesFields(t *testing.T) {
+	ts, client, store := newTestServer(t)
+	addDeviceTypes(t, store, "CPU")
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", DeviceTypeID: "CPU", TempMax: 70},
+		{ID: "b", Name: "S7-1200", DeviceTypeID: "CPU", TempMax: 60},
+	}})
+	res.Body.Close()
+
+	var page model.PartialDevicePage
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices?fields=id,name&sort=-tempMax&limit=1", nil), &page)
+	want := model.PartialDevice{"id": "a", "name": "S7-1500"}
+	if len(page.Devices) != 1 || !reflect.DeepEqual(page.Devices[0], want) || page.Next == "" {
+		t.Errorf("Expected %v and a next page, got: %v", want, page)
+	}
+
+	var device model.PartialDevice
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/b?fields=deviceTypeId", nil), &device)
+	if want := (model.PartialDevice{"deviceTypeId": "CPU"}); !reflect.DeepEqual(device, want) {
+		t.Errorf("Expected %v, got: %v", want, device)
+	}
+
+	for _, path := range []string{"/v1/devices?fields=name,color", "/v1/device/a?fields=color"} {
+		res := doJSON(t, client, http.MethodGet, ts.URL+path, nil)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got: %d", http.StatusBadRequest, path, res.StatusCode)
+		}
+	}
+}
+
+func TestBatchGetDevices(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500"},
+		{ID: "b", Name: "S7-1200"},
+		{ID: "c", Name: "ET 200SP"},
+	}})
+	res.Body.Close()
+
+	var batch model.DeviceBatch
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices:batchGet", model.DeviceBatchGet{IDs: []string{"c", "x", "a", "c"}}), &batch)
+	if len(batch.Devices) != 2 || batch.Devices[0].ID != "c" || batch.Devices[1].ID != "a" {
+		t.Errorf("Expected devices c and a, got: %v", batch.Devices)
+	}
+	if len(batch.Missing) != 1 || batch.Missing[0] != "x" {
+		t.Errorf("Expected x to be missing, got: %v", batch.Missing)
+	}
+
+	batch = model.DeviceBatch{}
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices:batchGet?id=b&id=a", nil), &batch)
+	if len(batch.Devices) != 2 || batch.Devices[0].ID != "b" || batch.Devices[1].ID != "a" || len(batch.Missing) != 0 {
+		t.Errorf("Expected devices b and a, got: %v", batch)
+	}
+
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices:batchGet", model.DeviceBatchGet{})
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d without ids, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestDeviceIDs(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	var results model.DeviceWriteResults
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{
+		"devices": []map[string]interface{}{{"name": "S7-1500"}},
+	}), &results)
+	id := results.Results[0].ID
+	if len(id) != 16 {
+		t.Fatalf("Expected a generated 16 character id, got: %q", id)
+	}
+
+	var device map[string]interface{}
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/"+id, nil), &device)
+	if device["id"] != id {
+		t.Errorf("Expected id %q in the JSON body, got: %v", id, device)
+	}
+}
+
+func TestPostDevicesValidation(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	var msg handler.APIError
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{"devices": []map[string]interface{}{
+		{"id": "a", "name": "S7-1500", "tempMin": 0, "tempMax": 60},
+		{"id": "", "name": "S7-1200", "tempMin": 70, "tempMax": 60, "installationPosition": "diagonal"},
+	}})
+	decodeBody(t, res, &msg)
+	want := []handler.ErrorDetail{
+		{Field: "devices[1].id", Rule: "required", Message: "id must not be empty, leave it out to generate one"},
+		{Field: "devices[1].tempMin", Rule: "lessOrEqual", Message: "tempMin must not be greater than tempMax"},
+		{Field: "devices[1].installationPosition", Rule: "oneOf", Message: "installationPosition must be one of horizontal, vertical"},
+	}
+	if res.StatusCode != http.StatusUnprocessableEntity || !reflect.DeepEqual(msg.Details, want) {
+		t.Errorf("Expected status %d with %v, got: %d %v", http.StatusUnprocessableEntity, want, res.StatusCode, msg)
+	}
+
+	var page model.DevicePage
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices", nil), &page)
+	if len(page.Devices) != 0 {
+		t.Errorf("Expected no device to be written, got: %v", page.Devices)
+	}
+
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/device/a", model.Device{Name: "S7-1500", TempMax: 200})
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for PUT, got: %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+}
+
+func TestPostDevicesMergeValidation(t *testing.T) {
+	ts, client, store := newTestServer(t)
+	if _, err := store.WriteDevicesDB(context.Background(), model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", TempMin: 0, TempMax: 60},
+	}}, database.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only tempMin is sent, it has to fit the stored tempMax.
+	var msg handler.APIError
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{"devices": []map[string]interface{}{
+		{"id": "a", "tempMin": 80},
+	}})
+	decodeBody(t, res, &msg)
+	want := []handler.ErrorDetail{
+		{Field: "devices[0].tempMin", Rule: "lessOrEqual", Message: "tempMin must not be greater than tempMax"},
+	}
+	if res.StatusCode != http.StatusUnprocessableEntity || !reflect.DeepEqual(msg.Details, want) {
+		t.Errorf("Expected status %d with %v, got: %d %v", http.StatusUnprocessableEntity, want, res.StatusCode, msg)
+	}
+
+	var device model.Device
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/a", nil), &device)
+	if device.TempMin != 0 {
+		t.Errorf("Expected the stored device to be kept, got: %v", device)
+	}
+
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{"devices": []map[string]interface{}{
+		{"id": "a", "tempMin": 20},
+	}})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d for a fitting tempMin, got: %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestDeviceTypes(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/device-types", model.DeviceType{ID: "beweis", Name: "Beweis"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated || res.Header.Get("Location") != "/v1/device-types/beweis" {
+		t.Fatalf("Expected status %d with location, got: %d %q", http.StatusCreated, res.StatusCode, res.Header.Get("Location"))
+	}
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/device-types/Beweis", model.DeviceType{Name: "Beweis"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status %d for a type that only differs in case, got: %d", http.StatusConflict, res.StatusCode)
+	}
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/device-types/io", model.DeviceType{Name: "IO"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, got: %d", http.StatusCreated, res.StatusCode)
+	}
+
+	var msg handler.APIError
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", DeviceTypeID: "beweis"},
+		{ID: "b", Name: "S7-1200", DeviceTypeID: "Beweis"},
+	}})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 || msg.Details[0].Field != "devices[1].deviceTypeId" {
+		t.Fatalf("Expected status %d for the unknown type, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{{ID: "a", Name: "S7-1500", DeviceTypeID: "beweis"}}})
+	res.Body.Close()
+
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/device-types/beweis", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status %d for a type with devices, got: %d", http.StatusConflict, res.StatusCode)
+	}
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/device-types/beweis?reassign=io", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var device model.Device
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/a", nil), &device)
+	if device.DeviceTypeID != "io" {
+		t.Errorf("Expected device a to be reassigned to io, got: %q", device.DeviceTypeID)
+	}
+
+	var types model.DeviceTypes
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device-types", nil), &types)
+	if len(types.DeviceTypes) != 1 || types.DeviceTypes[0].ID != "io" {
+		t.Errorf("Expected only device type io, got: %v", types.DeviceTypes)
+	}
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/device-types/beweis", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	var msg handler.APIError
+	res := doJSON(t, client, http.MethodPut, ts.URL+"/v1/device-types/switch", model.DeviceType{Name: "Switch",
+		AttributesSchema: json.RawMessage(`{"type": "nope"}`)})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 || msg.Details[0].Field != "attributesSchema" {
+		t.Fatalf("Expected status %d for an invalid schema, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/device-types/switch", model.DeviceType{Name: "Switch",
+		AttributesSchema: json.RawMessage(`{"required": ["ports"], "properties": {"ports": {"type": "integer", "minimum": 1}}}`)})
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got: %d", http.StatusCreated, res.StatusCode)
+	}
+
+	msg = handler.APIError{}
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "SCALANCE XB008", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 8}},
+		{ID: "b", Name: "SCALANCE XC224", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 0}},
+	}})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 ||
+		msg.Details[0].Field != "devices[1].attributes.ports" || msg.Details[0].Rule != "minimum" {
+		t.Fatalf("Expected status %d for ports 0, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "SCALANCE XB008", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 8}},
+		{ID: "b", Name: "SCALANCE XC224", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 24}},
+	}})
+	res.Body.Close()
+
+	// A merge of the attributes alone is checked against the stored type.
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{
+		"devices": []interface{}{map[string]interface{}{"id": "a", "attributes": map[string]interface{}{"ports": "eight"}}},
+	})
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for a merge breaking the schema, got: %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+
+	for query, want := range map[string]string{
+		"attributes.ports.gte=10":                              "b",
+		"attributes.ports=8":                                   "a",
+		"q=" + url.QueryEscape("attributes.ports < 10"):        "a",
+		"q=" + url.QueryEscape(`attributes.ports in (24, 48)`): "b",
+	} {
+		var page model.DevicePage
+		decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices?"+query, nil), &page)
+		if len(page.Devices) != 1 || page.Devices[0].ID != want {
+			t.Errorf("Expected device %s for %s, got: %v", want, query, page.Devices)
+		}
+	}
+}
+
+func TestDeviceRules(t *testing.T) {
+	rules, err := lint.Compile([]lint.Config{
+		{Name: "siplus-range", Severity: model.SeverityError, When: "siplusCatalog", Require: "tempMin <= -25 and tempMax >= 70"},
+		{Name: "axes-need-motion", Severity: model.SeverityWarning, When: "not motionEnable", Require: "rotationAxisNumber == 0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	srv := handler.ServerConfig{Rules: rules, MaxPageSize: 2}
+	ts := httptest.NewServer(srv.Routes(store))
+	t.Cleanup(ts.Close)
+	client := login(t, ts)
+
+	var msg handler.APIError
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "SIPLUS S7-1500", SiplusCatalog: true, TempMin: 0, TempMax: 60},
+	}})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 ||
+		msg.Details[0].Field != "devices[0]" || msg.Details[0].Rule != "siplus-range" {
+		t.Fatalf("Expected status %d for the error rule, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+
+	var results model.DeviceWriteResults
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "SIPLUS S7-1500", SiplusCatalog: true, TempMin: -40, TempMax: 70},
+		{ID: "b", Name: "S7-1500T", RotationAxisNumber: 2},
+	}})
+	decodeBody(t, res, &results)
+	if res.StatusCode != http.StatusOK || len(results.Results) != 2 || len(results.Results[0].Warnings) != 0 ||
+		len(results.Results[1].Warnings) != 1 || results.Results[1].Warnings[0].Rule != "axes-need-motion" {
+		t.Fatalf("Expected the warning on device b, got: %d %v", res.StatusCode, results)
+	}
+
+	// Merges are checked with the stored fields.
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", map[string]interface{}{
+		"devices": []interface{}{map[string]interface{}{"id": "a", "tempMax": 60}},
+	})
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for a merge breaking a rule, got: %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/device/b", model.Device{Name: "S7-1500T", RotationAxisNumber: 4})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Warning") != `299 - "axes-need-motion: device breaks rule axes-need-motion"` {
+		t.Errorf("Expected status %d with a warning, got: %d %q", http.StatusOK, res.StatusCode, res.Header.Get("Warning"))
+	}
+
+	// Devices stored before a rule existed only show up in the lint, which
+	// reads them in pages of two.
+	store.WriteDevicesDB(context.Background(), model.Devices{Devices: []model.Device{
+		{ID: "c", Name: "SIPLUS ET 200SP", SiplusCatalog: true},
+	}}, database.WriteOptions{})
+	var report model.LintReport
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices/lint", nil), &report)
+	if report.Checked != 3 || report.Errors != 1 || report.Warnings != 1 || len(report.Devices) != 2 ||
+		report.Devices[0].ID != "b" || report.Devices[1].ID != "c" {
+		t.Errorf("Unexpected lint report: %+v", report)
+	}
+	report = model.LintReport{}
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices/lint?severity=error", nil), &report)
+	if report.Errors != 1 || report.Warnings != 0 || len(report.Devices) != 1 {
+		t.Errorf("Expected only the error finding, got: %+v", report)
+	}
+}
+
+func TestPlanEnvironment(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", TempMin: -25, TempMax: 60, InstallationPosition: "horizontal", InsertInto19InchCabinet: true},
+		{ID: "b", Name: "ET 200SP", TempMin: 0, TempMax: 60, InsertInto19InchCabinet: true},
+		{ID: "c", Name: "S7-1200", TempMin: -20, TempMax: 55, InstallationPosition: "vertical", InsertInto19InchCabinet: true},
+		{ID: "d", Name: "LOGO!", TempMin: -20, TempMax: 55},
+	}})
+	res.Body.Close()
+
+	var plan model.EnvironmentPlan
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/planning/environment", map[string]interface{}{
+		"ambientMin": -10, "ambientMax": 50, "installationPosition": "horizontal", "insertInto19InchCabinet": true,
+		"deviceIds": []string{"a", "c", "x"},
+	})
+	decodeBody(t, res, &plan)
+	if res.StatusCode != http.StatusOK || len(plan.Devices) != 1 || plan.Devices[0].ID != "a" {
+		t.Fatalf("Expected only device a to suit the environment, got: %d %v", res.StatusCode, plan.Devices)
+	}
+	e := plan.Envelope
+	if e == nil || e.Suitable || *e.TempMin != -20 || *e.TempMax != 55 ||
+		len(e.Missing) != 1 || e.Missing[0] != "x" || len(e.Conflicts) != 2 {
+		t.Errorf("Unexpected envelope: %+v", e)
+	}
+
+	var msg handler.APIError
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/planning/environment", map[string]interface{}{"ambientMin": 60, "ambientMax": 50})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 || msg.Details[0].Field != "ambientMin" {
+		t.Errorf("Expected status %d for an inverted range, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+}
+
+func TestPlanMotion(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500T", MotionEnable: true, RotationAxisNumber: 2, PositionAxisNumber: 1},
+		{ID: "b", Name: "ET 200SP", RotationAxisNumber: 8},
+		{ID: "c", Name: "S7-1500T 4", MotionEnable: true, RotationAxisNumber: 4},
+		{ID: "d", Name: "SINAMICS", MotionEnable: true, PositionAxisNumber: 3},
+	}})
+	res.Body.Close()
+
+	var capacity model.MotionCapacity
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/planning/motion", map[string]interface{}{
+		"devices":      []map[string]interface{}{{"deviceId": "a", "quantity": 2}, {"deviceId": "b", "quantity": 1}, {"deviceId": "x", "quantity": 1}},
+		"rotationAxes": 9,
+		"positionAxes": 4,
+	})
+	decodeBody(t, res, &capacity)
+	if res.StatusCode != http.StatusOK || capacity.Covered || !capacity.Closable ||
+		capacity.RotationAxes != (model.AxisBalance{Required: 9, Available: 4, Margin: -5}) ||
+		capacity.PositionAxes != (model.AxisBalance{Required: 4, Available: 2, Margin: -2}) {
+		t.Fatalf("Unexpected capacity: %d %+v", res.StatusCode, capacity)
+	}
+	if !reflect.DeepEqual(capacity.Missing, []string{"x"}) || !reflect.DeepEqual(capacity.NotMotionEnabled, []string{"b"}) {
+		t.Errorf("Expected x to be missing and b not motion enabled, got: %v %v", capacity.Missing, capacity.NotMotionEnabled)
+	}
+	want := []model.MotionSuggestion{
+		{DeviceID: "a", Name: "S7-1500T", Quantity: 3, RotationAxes: 6, PositionAxes: 3},
+	}
+	if !reflect.DeepEqual(capacity.Suggestions, want) {
+		t.Errorf("Expected suggestions %v, got: %v", want, capacity.Suggestions)
+	}
+
+	var msg handler.APIError
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/planning/motion", map[string]interface{}{
+		"devices": []map[string]interface{}{{"deviceId": "a"}},
+	})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusUnprocessableEntity || len(msg.Details) != 1 || msg.Details[0].Field != "devices[0].quantity" {
+		t.Errorf("Expected status %d for a missing quantity, got: %d %v", http.StatusUnprocessableEntity, res.StatusCode, msg)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", InsertInto19InchCabinet: true},
+		{ID: "b", Name: "LOGO!"},
+	}})
+	res.Body.Close()
+
+	project := model.Project{ID: "line-1", Name: "Line 1", Cabinets: []model.Cabinet{{
+		ID: "main", Is19Inch: true,
+		Racks: []model.Rack{{ID: "r1", SlotCount: 4, Slots: []model.Slot{{Number: 1, DeviceID: "a"}}}},
+	}}}
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/projects", project)
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated || res.Header.Get("Location") != "/v1/projects/line-1" {
+		t.Fatalf("Expected status %d with a location, got: %d %q", http.StatusCreated, res.StatusCode, res.Header.Get("Location"))
+	}
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/projects", project)
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status %d for an existing project, got: %d", http.StatusConflict, res.StatusCode)
+	}
+
+	// Only devices with insertInto19InchCabinet fit the main cabinet.
+	var msg handler.APIError
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/projects/line-1/cabinets/main/racks",
+		model.Rack{ID: "r2", SlotCount: 2, Slots: []model.Slot{{Number: 1, DeviceID: "b"}, {Number: 2, DeviceID: "x"}}})
+	decodeBody(t, res, &msg)
+	want := []handler.ErrorDetail{
+		{Field: "slots[0].deviceId", Rule: validation.RuleFits, Message: `device "b" cannot be inserted into a 19 inch cabinet`},
+		{Field: "slots[1].deviceId", Rule: validation.RuleExists, Message: `device "x" does not exist`},
+	}
+	if res.StatusCode != http.StatusUnprocessableEntity || !reflect.DeepEqual(msg.Details, want) {
+		t.Errorf("Expected status %d with details %v, got: %d %v", http.StatusUnprocessableEntity, want, res.StatusCode, msg)
+	}
+
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/projects/line-1/cabinets/field",
+		model.Cabinet{Racks: []model.Rack{{ID: "r1", SlotCount: 2, Slots: []model.Slot{{Number: 2, DeviceID: "b"}}}}})
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated || res.Header.Get("Location") != "/v1/projects/line-1/cabinets/field" {
+		t.Errorf("Expected status %d for a new cabinet, got: %d", http.StatusCreated, res.StatusCode)
+	}
+
+	// Replacing the project needs the version the cabinet change left.
+	var stored model.Project
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/projects/line-1", nil), &stored)
+	if stored.Version != 2 {
+		t.Fatalf("Expected version 2 after the cabinet change, got: %+v", stored)
+	}
+	msg = handler.APIError{}
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/projects/line-1", project)
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusConflict || msg.Message != handler.ErrProjectChanged.Message {
+		t.Errorf("Expected %v for a stale version, got: %d %v", handler.ErrProjectChanged, res.StatusCode, msg)
+	}
+	var replaced model.Project
+	res = doJSON(t, client, http.MethodPut, ts.URL+"/v1/projects/line-1", stored)
+	decodeBody(t, res, &replaced)
+	if res.StatusCode != http.StatusOK || replaced.Version != 3 {
+		t.Errorf("Expected status %d with version 3, got: %d %+v", http.StatusOK, res.StatusCode, replaced)
+	}
+
+	// Deleted devices stay in the project and are reported by the view.
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/device/b", nil)
+	res.Body.Close()
+	var view model.ProjectView
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/projects/line-1/view", nil)
+	decodeBody(t, res, &view)
+	if res.StatusCode != http.StatusOK || len(view.Cabinets) != 2 || !reflect.DeepEqual(view.Missing, []string{"b"}) {
+		t.Fatalf("Unexpected view: %d %+v", res.StatusCode, view)
+	}
+	if slot := view.Cabinets[0].Racks[0].Slots[0]; slot.Device == nil || slot.Device.Name != "S7-1500" {
+		t.Errorf("Expected device a to be resolved, got: %+v", slot)
+	}
+	if slot := view.Cabinets[1].Racks[0].Slots[0]; slot.DeviceID != "b" || slot.Device != nil {
+		t.Errorf("Expected device b to be missing, got: %+v", slot)
+	}
+
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/projects/line-1/cabinets/main/racks/r1", nil)
+	res.Body.Close()
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/projects/line-1/cabinets/main/racks/r1", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for a deleted rack, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	res = doJSON(t, client, http.MethodDelete, ts.URL+"/v1/projects/line-1", nil)
+	res.Body.Close()
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/projects/line-1/cabinets", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d for a deleted project, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestSearchDevices(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", Failsafe: true, TempMax: 70},
+		{ID: "b", Name: "S7-1200", Failsafe: true, TempMax: 60},
+		{ID: "c", Name: "ET 200SP", SiplusCatalog: true},
+		{ID: "d", Name: "ET 200MP"},
+	}})
+	res.Body.Close()
+
+	expr := "(failsafe and tempMax>=70) or siplusCatalog"
+	var page model.DevicePage
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices?q="+url.QueryEscape(expr), nil), &page)
+	if len(page.Devices) != 2 || page.Devices[0].ID != "a" || page.Devices[1].ID != "c" {
+		t.Errorf("Expected devices a and c, got: %v", page.Devices)
+	}
+
+	search := model.DeviceSearch{Query: expr, Sort: "-name", Limit: 1}
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices/search", search), &page)
+	if len(page.Devices) != 1 || page.Devices[0].ID != "a" || page.Next == "" {
+		t.Fatalf("Expected device a and a next page, got: %v", page)
+	}
+	search.Cursor, page = page.Next, model.DevicePage{}
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices/search", search), &page)
+	if len(page.Devices) != 1 || page.Devices[0].ID != "c" || page.Next != "" {
+		t.Errorf("Expected device c on the last page, got: %v", page)
+	}
+
+	var msg handler.APIError
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices/search", model.DeviceSearch{Query: "failsafe and color"})
+	decodeBody(t, res, &msg)
+	if res.StatusCode != http.StatusBadRequest || len(msg.Details) != 1 || msg.Details[0].Position != 14 {
+		t.Errorf("Expected status %d with the error position, got: %d %v", http.StatusBadRequest, res.StatusCode, msg)
+	}
+
+	// Deep nesting and huge bodies are rejected before they cost the server
+	// its stack or memory.
+	deep := strings.Repeat("(", 10000) + "failsafe" + strings.Repeat(")", 10000)
+	for name, search := range map[string]model.DeviceSearch{
+		"nested":    {Query: strings.Repeat("not ", 1000) + "failsafe"},
+		"too large": {Query: strings.Repeat(deep, 10)},
+	} {
+		res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices/search", search)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d for a %s query, got: %d", http.StatusBadRequest, name, res.StatusCode)
+		}
+	}
+}
+
+func TestTextSearchAndSuggest(t *testing.T) {
+	ts, client, store := newTestServer(t)
+	addDeviceTypes(t, store, "CPU", "IO")
+
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{
+		{ID: "a", Name: "S7-1500", DeviceTypeID: "CPU"},
+		{ID: "b", Name: "ET 200SP CPU", DeviceTypeID: "CPU"},
+		{ID: "c", Name: "ET 200MP", DeviceTypeID: "IO"},
+	}})
+	res.Body.Close()
+
+	var matches model.DeviceMatches
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices/search?text=cpu", nil), &matches)
+	if len(matches.Matches) != 2 || matches.Matches[0].Device.ID != "b" || matches.Matches[1].Device.ID != "a" {
+		t.Errorf("Expected matches b and a, got: %v", matches.Matches)
+	}
+
+	var suggestions model.DeviceSuggestions
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/devices/suggest?prefix=et&limit=1", nil), &suggestions)
+	if len(suggestions.Suggestions) != 1 || suggestions.Suggestions[0] != "ET 200MP" {
+		t.Errorf("Expected suggestion ET 200MP, got: %v", suggestions.Suggestions)
+	}
+
+	for _, path := range []string{"/v1/devices/search", "/v1/devices/suggest", "/v1/devices/suggest?prefix=e&limit=x"} {
+		res := doJSON(t, client, http.MethodGet, ts.URL+path, nil)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got: %d", http.StatusBadRequest, path, res.StatusCode)
+		}
+	}
+}
+
+func TestPutDevice(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+	url := ts.URL + "/v1/device/1glmLrTZqf9YZleN"
+
+	device := model.Device{Name: "S7-1500", Failsafe: true, TempMax: 60}
+	var got model.Device
+	res := doJSON(t, client, http.MethodPut, url, device)
+	decodeBody(t, res, &got)
+	if res.StatusCode != http.StatusCreated || res.Header.Get("Location") != "/v1/device/1glmLrTZqf9YZleN" {
+		t.Errorf("Expected status %d with Location, got: %d %q", http.StatusCreated, res.StatusCode, res.Header.Get("Location"))
+	}
+	if got.ID != "1glmLrTZqf9YZleN" {
+		t.Errorf("Expected the id from the path, got: %v", got)
+	}
+
+	// Fields left out are reset by the replace.
+	device = model.Device{ID: "1glmLrTZqf9YZleN", Name: "S7-1518"}
+	for i := 0; i < 2; i++ {
+		res = doJSON(t, client, http.MethodPut, url, device)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d on replace, got: %d", http.StatusOK, res.StatusCode)
+		}
+	}
+	decodeBody(t, doJSON(t, client, http.MethodGet, url, nil), &got)
+	if !reflect.DeepEqual(got, device) {
+		t.Errorf("Expected %v after replace, got: %v", device, got)
+	}
+
+	res = doJSON(t, client, http.MethodPut, url, model.Device{ID: "other"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for mismatching id, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestPostDevicesModes(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	device := model.Device{ID: "1glmLrTZqf9YZleN", Name: "S7-1500", Failsafe: true, TempMax: 60}
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{device}})
+	res.Body.Close()
+
+	// Only tempMax is sent, merge has to keep the name and failsafe.
+	partial := map[string]interface{}{"devices": []map[string]interface{}{{"id": device.ID, "tempMax": 0}}}
+	var written model.DeviceWriteResults
+	decodeBody(t, doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", partial), &written)
+	if written.Results[0].Status != model.WriteUpdated || written.Results[0].Mode != model.WriteModeMerge {
+		t.Errorf("Expected merged update, got: %v", written.Results)
+	}
+
+	var got model.Device
+	decodeBody(t, doJSON(t, client, http.MethodGet, ts.URL+"/v1/device/"+device.ID, nil), &got)
+	want := device
+	want.TempMax = 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after merge, got: %v", want, got)
+	}
+
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices?mode=create", model.Devices{Devices: []model.Device{device}})
+	decodeBody(t, res, &written)
+	if res.StatusCode != http.StatusConflict || written.Results[0].Status != model.WriteConflict {
+		t.Errorf("Expected status %d and a conflict, got: %d %v", http.StatusConflict, res.StatusCode, written.Results)
+	}
+
+	res = doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices?mode=upsert", partial)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown mode, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func doPatch(t *testing.T, client *http.Client, url, contentType, patch string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPatch, url, strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestPatchDevice(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	device := model.Device{ID: "1glmLrTZqf9YZleN", Name: "S7-1500", Failsafe: true, TempMax: 60}
+	res := doJSON(t, client, http.MethodPost, ts.URL+"/v1/devices", model.Devices{Devices: []model.Device{device}})
+	res.Body.Close()
+	url := ts.URL + "/v1/device/" + device.ID
+
+	var got model.Device
+	res = doPatch(t, client, url, "application/merge-patch+json", `{"tempMax": 70, "failsafe": null}`)
+	decodeBody(t, res, &got)
+	want := device
+	want.TempMax, want.Failsafe = 70, false
+	if res.StatusCode != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after merge patch, got: %d %v", want, res.StatusCode, got)
+	}
+
+	res = doPatch(t, client, url, "application/json-patch+json",
+		`[{"op": "test", "path": "/tempMax", "value": 70}, {"op": "replace", "path": "/name", "value": "S7-1518"}]`)
+	decodeBody(t, res, &got)
+	if res.StatusCode != http.StatusOK || got.Name != "S7-1518" || got.TempMax != 70 {
+		t.Errorf("Expected renamed device after json patch, got: %d %v", res.StatusCode, got)
+	}
+
+	var stored model.Device
+	decodeBody(t, doJSON(t, client, http.MethodGet, url, nil), &stored)
+	if !reflect.DeepEqual(stored, got) {
+		t.Errorf("Expected patched device to be stored, got: %v", stored)
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		patch       string
+		code        int
+	}{
+		{"unknown device", ts.URL + "/v1/device/unknown", "application/merge-patch+json", `{}`, http.StatusNotFound},
+		{"plain json", url, "application/json", `{}`, http.StatusUnsupportedMediaType},
+		{"invalid patch", url, "application/json-patch+json", `{"op": "replace"}`, http.StatusBadRequest},
+		{"failed test", url, "application/json-patch+json", `[{"op": "test", "path": "/tempMax", "value": 1}]`, http.StatusConflict},
+		{"wrong type", url, "application/merge-patch+json", `{"tempMax": "hot"}`, http.StatusUnprocessableEntity},
+		{"unknown field", url, "application/merge-patch+json", `{"color": "red"}`, http.StatusUnprocessableEntity},
+		{"changed id", url, "application/json-patch+json", `[{"op": "replace", "path": "/id", "value": "x"}]`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := doPatch(t, client, tt.url, tt.contentType, tt.patch)
+			res.Body.Close()
+			if res.StatusCode != tt.code {
+				t.Errorf("Expected status %d, got: %d", tt.code, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+
+	res := doJSON(t, client, http.MethodPut, ts.URL+"/v1/auth", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	res = doJSON(t, client, http.MethodGet, ts.URL+"/v1/session", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after logout, got: %d", http.StatusUnauthorized, res.StatusCode)
+	}
+}
+
+func TestDBError(t *testing.T) {
+	timeout := handler.DBError(context.DeadlineExceeded)
+	if timeout.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d for an exceeded deadline, got: %d", http.StatusGatewayTimeout, timeout.Code)
+	}
+
+	canceled := handler.DBError(context.Canceled)
+	if canceled.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d for a canceled context, got: %d", http.StatusServiceUnavailable, canceled.Code)
+	}
+
+	notReady := handler.DBError(errors.New(database.ErrNotReady))
+	if notReady.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while the database is not ready, got: %d", http.StatusServiceUnavailable, notReady.Code)
+	}
+
+	other := handler.DBError(errors.New("boom"))
+	if other.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d for other errors, got: %d", http.StatusInternalServerError, other.Code)
+	}
+}
+
+func TestReady(t *testing.T) {
+	ts := httptest.NewServer((&handler.ServerConfig{}).Routes(database.NewMemoryStore()))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/v1/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+}
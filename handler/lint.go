@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/lint"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+)
+
+// ErrRuleEvaluation reports a catalog rule that could not be evaluated for a
+// device, which is a problem of the configured rules, not of the request.
+var ErrRuleEvaluation = APIError{Code: 500, Message: "catalog rule could not be evaluated"}
+
+// ruleError returns the response for a catalog rule that failed to evaluate.
+func ruleError(err error) APIError {
+	return withReason(ErrRuleEvaluation, err)
+}
+
+// HandleLintDevices checks every stored device against the catalog rules and
+// reports the devices that break at least one. ?severity=error or
+// ?severity=warning only reports findings of that severity. The devices are
+// read in pages of maxPageSize.
+func HandleLintDevices(w http.ResponseWriter, r *http.Request, mg database.Store, catalog lint.Rules, maxPageSize int64) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	severity := r.URL.Query().Get("severity")
+	if severity != "" && severity != model.SeverityError && severity != model.SeverityWarning {
+		msg := ErrInvalidQuery("severity", severity)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	report := model.LintReport{Devices: []model.DeviceLint{}}
+	for q := query.All(maxPageSize); ; {
+		devices, err := mg.GetDeviceDB(r.Context(), q.FindFilter(), q.FindOptions())
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		page, next := q.Next(devices.Devices)
+		if err := lintDevices(&report, catalog, page, severity); err != nil {
+			msg := ruleError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		if next == nil {
+			break
+		}
+		q.Cursor = next
+	}
+	HTTPJsonMsg(w, report, http.StatusOK)
+	return nil
+}
+
+// lintDevices adds the findings of devices with the given severity, or all
+// of them when severity is empty, to report.
+func lintDevices(report *model.LintReport, catalog lint.Rules, devices []model.Device, severity string) error {
+	report.Checked += len(devices)
+	for _, device := range devices {
+		findings, err := catalog.Check(device)
+		if err != nil {
+			return err
+		}
+		if severity != "" {
+			findings = lint.WithSeverity(findings, severity)
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		for _, f := range findings {
+			if f.Severity == model.SeverityError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+		}
+		report.Devices = append(report.Devices, model.DeviceLint{ID: device.ID, Name: device.Name, Findings: findings})
+	}
+	return nil
+}
+
+// ruleFindings checks devices against the catalog rules. devices have to be
+// as they will be stored, see mergeStored. The result is indexed like
+// devices, or nil without rules.
+func ruleFindings(catalog lint.Rules, devices []model.Device) ([][]model.RuleFinding, error) {
+	if len(catalog) == 0 {
+		return nil, nil
+	}
+	findings := make([][]model.RuleFinding, len(devices))
+	for i, device := range devices {
+		f, err := catalog.Check(device)
+		if err != nil {
+			return nil, err
+		}
+		findings[i] = f
+	}
+	return findings, nil
+}
+
+// ruleViolations turns the findings with severity error into violations
+// named after the rule. With batch set the field names the device, like
+// devices[2].
+func ruleViolations(findings [][]model.RuleFinding, batch bool) []validation.Violation {
+	var violations []validation.Violation
+	for i, list := range findings {
+		for _, f := range lint.WithSeverity(list, model.SeverityError) {
+			v := validation.Violation{Rule: f.Rule, Message: f.Message}
+			if batch {
+				v.Field = fmt.Sprintf("devices[%d]", i)
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// setRuleWarnings adds a Warning header with code 299 (miscellaneous
+// persistent warning) for every finding with severity warning in findings,
+// which holds the findings of a single device. The text is quoted in ASCII
+// as header values should be.
+func setRuleWarnings(w http.ResponseWriter, findings [][]model.RuleFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	for _, f := range lint.WithSeverity(findings[0], model.SeverityWarning) {
+		w.Header().Add("Warning", fmt.Sprintf("299 - %+q", f.Rule+": "+f.Message))
+	}
+}
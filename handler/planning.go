@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/planning"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrEnvironmentValidation = APIError{Code: 422, Message: "environment breaks validation rules"}
+	ErrMotionValidation      = APIError{Code: 422, Message: "motion requirement breaks validation rules"}
+)
+
+// HandlePlanEnvironment answers which devices can run in the environment of
+// the body, at most limit of them ordered by id. With deviceIds it also
+// computes the operating envelope of those devices.
+func HandlePlanEnvironment(w http.ResponseWriter, r *http.Request, mg database.Store, rules validation.Rules, maxPageSize int64) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var env model.Environment
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if violations := rules.Environment(env); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrEnvironmentValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+	ids := uniqueIDs(env.DeviceIDs)
+	if len(ids) > maxBatchGetIDs {
+		HTTPJsonMsg(w, ErrTooManyDeviceIDs, ErrTooManyDeviceIDs.Code)
+		return errors.New(ErrTooManyDeviceIDs.Message)
+	}
+
+	limit := maxPageSize
+	if limit <= 0 {
+		limit = query.DefaultMaxPageSize
+	}
+	if env.Limit > 0 {
+		limit = min(env.Limit, limit)
+	}
+	matches, err := mg.GetDeviceDB(r.Context(), planning.Filter(env),
+		database.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: limit})
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	plan := model.EnvironmentPlan{Devices: matches.Devices}
+	if plan.Devices == nil {
+		plan.Devices = []model.Device{}
+	}
+
+	if len(ids) > 0 {
+		selected, err := mg.GetDeviceDB(r.Context(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		found := make(map[string]model.Device, len(selected.Devices))
+		for _, device := range selected.Devices {
+			found[device.ID] = device
+		}
+		var devices []model.Device
+		var missing []string
+		for _, id := range ids {
+			if device, ok := found[id]; ok {
+				devices = append(devices, device)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+		envelope := planning.Envelope(env, devices)
+		if missing != nil {
+			envelope.Missing = missing
+			envelope.Suitable = false
+		}
+		plan.Envelope = &envelope
+	}
+
+	HTTPJsonMsg(w, plan, http.StatusOK)
+	return nil
+}
+
+// HandlePlanMotion compares the rotary and positioning axes of the selected
+// devices with the required ones. When axes are missing it suggests the
+// fewest motion-enabled devices of the catalog that provide them.
+func HandlePlanMotion(w http.ResponseWriter, r *http.Request, mg database.Store, rules validation.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var req model.MotionRequirement
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if violations := rules.Motion(req); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrMotionValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+	ids := make([]string, len(req.Devices))
+	for i, line := range req.Devices {
+		ids[i] = line.DeviceID
+	}
+	ids = uniqueIDs(ids)
+	if len(ids) > maxBatchGetIDs {
+		HTTPJsonMsg(w, ErrTooManyDeviceIDs, ErrTooManyDeviceIDs.Code)
+		return errors.New(ErrTooManyDeviceIDs.Message)
+	}
+
+	var selected model.Devices
+	if len(ids) > 0 {
+		selected, err = mg.GetDeviceDB(r.Context(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+	}
+	capacity := planning.Capacity(req, selected.Devices)
+
+	if !capacity.Covered {
+		catalog, err := mg.GetDeviceDB(r.Context(), planning.MotionFilter(),
+			database.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}})
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		capacity.Suggestions, capacity.Closable = planning.Suggest(
+			-capacity.RotationAxes.Margin, -capacity.PositionAxes.Margin, catalog.Devices)
+	}
+
+	HTTPJsonMsg(w, capacity, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,639 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrProjectNotFound   = APIError{Code: 404, Message: "project not found"}
+	ErrProjectExists     = APIError{Code: 409, Message: "project already exists"}
+	ErrProjectValidation = APIError{Code: 422, Message: "project breaks validation rules"}
+	ErrProjectIDMismatch = APIError{Code: 400, Message: "project id in body does not match the path"}
+	ErrProjectChanged    = APIError{Code: 409, Message: "project was changed in the meantime, load it again"}
+	ErrCabinetNotFound   = APIError{Code: 404, Message: "cabinet not found"}
+	ErrCabinetExists     = APIError{Code: 409, Message: "cabinet already exists"}
+	ErrCabinetIDMismatch = APIError{Code: 400, Message: "cabinet id in body does not match the path"}
+	ErrRackNotFound      = APIError{Code: 404, Message: "rack not found"}
+	ErrRackExists        = APIError{Code: 409, Message: "rack already exists"}
+	ErrRackIDMismatch    = APIError{Code: 400, Message: "rack id in body does not match the path"}
+)
+
+// projectError maps the errors of the project store to API errors.
+func projectError(err error) APIError {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return ErrProjectNotFound
+	case err.Error() == database.ErrProjectExists:
+		return ErrProjectExists
+	case err.Error() == database.ErrProjectVersion:
+		return ErrProjectChanged
+	}
+	return DBError(err)
+}
+
+// loadProject checks the session and the database and returns the project
+// with the given id. On failure it writes the error response itself.
+func loadProject(w http.ResponseWriter, r *http.Request, mg database.Store, id string) (model.Project, error) {
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return model.Project{}, err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return model.Project{}, err
+	}
+
+	projects, err := mg.GetProjectsDB(r.Context(), []string{id})
+	if err == nil && len(projects) == 0 {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return model.Project{}, err
+	}
+	return projects[0], nil
+}
+
+// saveProject stores a project changed by a cabinet or rack handler and
+// answers with body. The change is based on the version loadProject read, if
+// another request changed the project since, it fails with 409.
+func saveProject(w http.ResponseWriter, r *http.Request, mg database.Store, p model.Project, body interface{}, location string, created bool) error {
+	if _, err := mg.PutProjectDB(r.Context(), p, false); err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	code := http.StatusOK
+	if created {
+		w.Header().Set("Location", location)
+		code = http.StatusCreated
+	}
+	HTTPJsonMsg(w, body, code)
+	return nil
+}
+
+func HandleGetProjects(w http.ResponseWriter, r *http.Request, mg database.Store) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	projects, err := mg.GetProjectsDB(r.Context(), nil)
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if projects == nil {
+		projects = []model.Project{}
+	}
+	HTTPJsonMsg(w, model.Projects{Projects: projects}, http.StatusOK)
+	return nil
+}
+
+func HandleGetProject(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, id)
+	if err != nil {
+		return err
+	}
+	HTTPJsonMsg(w, p, http.StatusOK)
+	return nil
+}
+
+// HandlePostProject creates the project in the body.
+func HandlePostProject(w http.ResponseWriter, r *http.Request, mg database.Store, rules validation.Rules) error {
+	return putProject(w, r, mg, "", rules)
+}
+
+// HandlePutProject creates or replaces the project with the given id,
+// including all of its cabinets and racks.
+func HandlePutProject(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules) error {
+	return putProject(w, r, mg, id, rules)
+}
+
+// putProject stores the project in the body. Without id it has to be a new
+// one, otherwise it is stored under id and has to carry the stored version.
+func putProject(w http.ResponseWriter, r *http.Request, mg database.Store, id string, rules validation.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	var p model.Project
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if id != "" && p.ID == "" {
+		p.ID = id
+	}
+	if id != "" && p.ID != id {
+		HTTPJsonMsg(w, ErrProjectIDMismatch, ErrProjectIDMismatch.Code)
+		return errors.New(ErrProjectIDMismatch.Message)
+	}
+
+	violations := rules.Project(p)
+	found, err := slotViolations(r.Context(), mg, projectPlacements(p))
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if violations = append(violations, found...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrProjectValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	created, err := mg.PutProjectDB(r.Context(), p, id == "")
+	if err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	p.Version++
+
+	code := http.StatusOK
+	if created {
+		w.Header().Set("Location", "/v1/projects/"+url.PathEscape(p.ID))
+		code = http.StatusCreated
+	}
+	HTTPJsonMsg(w, p, code)
+	return nil
+}
+
+// HandleDeleteProject deletes a project with its cabinets and racks. The
+// devices they hold stay in the catalog.
+func HandleDeleteProject(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	msg, err := CheckAuth(r, mg)
+	if err != nil {
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	err = mg.ClientStatusDB()
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+
+	if err := mg.DeleteProjectDB(r.Context(), id); err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	return nil
+}
+
+// HandleGetProjectView returns the project with the devices of its slots
+// resolved. Devices deleted from the catalog since they were placed are
+// listed as missing.
+func HandleGetProjectView(w http.ResponseWriter, r *http.Request, mg database.Store, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, id)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, place := range projectPlacements(p) {
+		ids = append(ids, place.deviceID)
+	}
+	devices := make(map[string]model.Device)
+	if ids = uniqueIDs(ids); len(ids) > 0 {
+		found, err := mg.GetDeviceDB(r.Context(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+		if err != nil {
+			msg := DBError(err)
+			HTTPJsonMsg(w, msg, msg.Code)
+			return err
+		}
+		for _, device := range found.Devices {
+			devices[device.ID] = device
+		}
+	}
+
+	view := model.ProjectView{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Cabinets:    make([]model.CabinetView, len(p.Cabinets)),
+		Missing:     []string{},
+	}
+	for _, id := range ids {
+		if _, ok := devices[id]; !ok {
+			view.Missing = append(view.Missing, id)
+		}
+	}
+	for i, c := range p.Cabinets {
+		cv := model.CabinetView{ID: c.ID, Name: c.Name, Is19Inch: c.Is19Inch, Racks: make([]model.RackView, len(c.Racks))}
+		for j, rack := range c.Racks {
+			rv := model.RackView{ID: rack.ID, Name: rack.Name, SlotCount: rack.SlotCount, Slots: make([]model.SlotView, len(rack.Slots))}
+			for k, slot := range rack.Slots {
+				rv.Slots[k] = model.SlotView{Number: slot.Number, DeviceID: slot.DeviceID}
+				if device, ok := devices[slot.DeviceID]; ok {
+					rv.Slots[k].Device = &device
+				}
+			}
+			cv.Racks[j] = rv
+		}
+		view.Cabinets[i] = cv
+	}
+	HTTPJsonMsg(w, view, http.StatusOK)
+	return nil
+}
+
+func HandleGetCabinets(w http.ResponseWriter, r *http.Request, mg database.Store, projectID string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	if p.Cabinets == nil {
+		p.Cabinets = []model.Cabinet{}
+	}
+	HTTPJsonMsg(w, model.Cabinets{Cabinets: p.Cabinets}, http.StatusOK)
+	return nil
+}
+
+func HandleGetCabinet(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, id)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	HTTPJsonMsg(w, p.Cabinets[i], http.StatusOK)
+	return nil
+}
+
+// HandlePostCabinet adds the cabinet in the body to a project.
+func HandlePostCabinet(w http.ResponseWriter, r *http.Request, mg database.Store, projectID string, rules validation.Rules) error {
+	return putCabinet(w, r, mg, projectID, "", rules)
+}
+
+// HandlePutCabinet creates or replaces a cabinet of a project, including
+// all of its racks.
+func HandlePutCabinet(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, id string, rules validation.Rules) error {
+	return putCabinet(w, r, mg, projectID, id, rules)
+}
+
+// putCabinet stores the cabinet in the body in a project. Without id it has
+// to be a new one, otherwise it is stored under id. Violations are reported
+// for fields of the cabinet, like racks[0].slotCount.
+func putCabinet(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, id string, rules validation.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+
+	var c model.Cabinet
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if id != "" && c.ID == "" {
+		c.ID = id
+	}
+	if id != "" && c.ID != id {
+		HTTPJsonMsg(w, ErrCabinetIDMismatch, ErrCabinetIDMismatch.Code)
+		return errors.New(ErrCabinetIDMismatch.Message)
+	}
+
+	violations := rules.Cabinet(c)
+	found, err := slotViolations(r.Context(), mg, cabinetPlacements("", c))
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if violations = append(violations, found...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrProjectValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	i := findCabinet(p, c.ID)
+	switch {
+	case i >= 0 && id == "":
+		HTTPJsonMsg(w, ErrCabinetExists, ErrCabinetExists.Code)
+		return errors.New(ErrCabinetExists.Message)
+	case i >= 0:
+		p.Cabinets[i] = c
+	default:
+		p.Cabinets = append(p.Cabinets, c)
+	}
+	location := fmt.Sprintf("/v1/projects/%s/cabinets/%s", url.PathEscape(p.ID), url.PathEscape(c.ID))
+	return saveProject(w, r, mg, p, c, location, i < 0)
+}
+
+// HandleDeleteCabinet removes a cabinet with its racks from a project.
+func HandleDeleteCabinet(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, id)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	p.Cabinets = slices.Delete(p.Cabinets, i, i+1)
+	if _, err := mg.PutProjectDB(r.Context(), p, false); err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	return nil
+}
+
+func HandleGetRacks(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, cabinetID)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	racks := p.Cabinets[i].Racks
+	if racks == nil {
+		racks = []model.Rack{}
+	}
+	HTTPJsonMsg(w, model.Racks{Racks: racks}, http.StatusOK)
+	return nil
+}
+
+func HandleGetRack(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, cabinetID)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	j := findRack(p.Cabinets[i], id)
+	if j < 0 {
+		HTTPJsonMsg(w, ErrRackNotFound, ErrRackNotFound.Code)
+		return errors.New(ErrRackNotFound.Message)
+	}
+	HTTPJsonMsg(w, p.Cabinets[i].Racks[j], http.StatusOK)
+	return nil
+}
+
+// HandlePostRack adds the rack in the body to a cabinet.
+func HandlePostRack(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID string, rules validation.Rules) error {
+	return putRack(w, r, mg, projectID, cabinetID, "", rules)
+}
+
+// HandlePutRack creates or replaces a rack of a cabinet.
+func HandlePutRack(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID, id string, rules validation.Rules) error {
+	return putRack(w, r, mg, projectID, cabinetID, id, rules)
+}
+
+// putRack stores the rack in the body in a cabinet. Without id it has to be
+// a new one, otherwise it is stored under id. Violations are reported for
+// fields of the rack, like slots[2].deviceId.
+func putRack(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID, id string, rules validation.Rules) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, cabinetID)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	c := &p.Cabinets[i]
+
+	var rack model.Rack
+	if err := json.NewDecoder(r.Body).Decode(&rack); err != nil {
+		HTTPJsonMsg(w, ErrWrongStructure, http.StatusBadRequest)
+		return err
+	}
+	if id != "" && rack.ID == "" {
+		rack.ID = id
+	}
+	if id != "" && rack.ID != id {
+		HTTPJsonMsg(w, ErrRackIDMismatch, ErrRackIDMismatch.Code)
+		return errors.New(ErrRackIDMismatch.Message)
+	}
+
+	violations := rules.Rack(rack)
+	found, err := slotViolations(r.Context(), mg, rackPlacements("", rack, c.Is19Inch))
+	if err != nil {
+		msg := DBError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	if violations = append(violations, found...); len(violations) > 0 {
+		msg := ValidationError(violations)
+		msg.Message = ErrProjectValidation.Message
+		HTTPJsonMsg(w, msg, msg.Code)
+		return errors.New(msg.Message)
+	}
+
+	j := findRack(*c, rack.ID)
+	switch {
+	case j >= 0 && id == "":
+		HTTPJsonMsg(w, ErrRackExists, ErrRackExists.Code)
+		return errors.New(ErrRackExists.Message)
+	case j >= 0:
+		c.Racks[j] = rack
+	default:
+		c.Racks = append(c.Racks, rack)
+	}
+	location := fmt.Sprintf("/v1/projects/%s/cabinets/%s/racks/%s",
+		url.PathEscape(p.ID), url.PathEscape(c.ID), url.PathEscape(rack.ID))
+	return saveProject(w, r, mg, p, rack, location, j < 0)
+}
+
+// HandleDeleteRack removes a rack from a cabinet.
+func HandleDeleteRack(w http.ResponseWriter, r *http.Request, mg database.Store, projectID, cabinetID, id string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	p, err := loadProject(w, r, mg, projectID)
+	if err != nil {
+		return err
+	}
+	i := findCabinet(p, cabinetID)
+	if i < 0 {
+		HTTPJsonMsg(w, ErrCabinetNotFound, ErrCabinetNotFound.Code)
+		return errors.New(ErrCabinetNotFound.Message)
+	}
+	j := findRack(p.Cabinets[i], id)
+	if j < 0 {
+		HTTPJsonMsg(w, ErrRackNotFound, ErrRackNotFound.Code)
+		return errors.New(ErrRackNotFound.Message)
+	}
+	p.Cabinets[i].Racks = slices.Delete(p.Cabinets[i].Racks, j, j+1)
+	if _, err := mg.PutProjectDB(r.Context(), p, false); err != nil {
+		msg := projectError(err)
+		HTTPJsonMsg(w, msg, msg.Code)
+		return err
+	}
+	return nil
+}
+
+func findCabinet(p model.Project, id string) int {
+	return slices.IndexFunc(p.Cabinets, func(c model.Cabinet) bool { return c.ID == id })
+}
+
+func findRack(c model.Cabinet, id string) int {
+	return slices.IndexFunc(c.Racks, func(r model.Rack) bool { return r.ID == id })
+}
+
+// placement is a device in a slot. field names the slot, like
+// cabinets[0].racks[1].slots[2].
+type placement struct {
+	field    string
+	deviceID string
+	is19Inch bool
+}
+
+func projectPlacements(p model.Project) []placement {
+	var places []placement
+	for i, c := range p.Cabinets {
+		places = append(places, cabinetPlacements(fmt.Sprintf("cabinets[%d].", i), c)...)
+	}
+	return places
+}
+
+func cabinetPlacements(prefix string, c model.Cabinet) []placement {
+	var places []placement
+	for i, rack := range c.Racks {
+		places = append(places, rackPlacements(fmt.Sprintf("%sracks[%d].", prefix, i), rack, c.Is19Inch)...)
+	}
+	return places
+}
+
+func rackPlacements(prefix string, rack model.Rack, is19Inch bool) []placement {
+	places := make([]placement, 0, len(rack.Slots))
+	for i, slot := range rack.Slots {
+		if slot.DeviceID == "" {
+			continue
+		}
+		places = append(places, placement{
+			field:    fmt.Sprintf("%sslots[%d]", prefix, i),
+			deviceID: slot.DeviceID,
+			is19Inch: is19Inch,
+		})
+	}
+	return places
+}
+
+// slotViolations reports slots with devices that are not in the catalog and
+// devices in 19 inch cabinets that cannot be inserted into one.
+func slotViolations(ctx context.Context, mg database.Store, places []placement) ([]validation.Violation, error) {
+	ids := make([]string, len(places))
+	for i, place := range places {
+		ids[i] = place.deviceID
+	}
+	if ids = uniqueIDs(ids); len(ids) == 0 {
+		return nil, nil
+	}
+	found, err := mg.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, database.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]model.Device, len(found.Devices))
+	for _, device := range found.Devices {
+		devices[device.ID] = device
+	}
+
+	var violations []validation.Violation
+	for _, place := range places {
+		device, ok := devices[place.deviceID]
+		switch {
+		case !ok:
+			violations = append(violations, validation.Violation{
+				Field:   place.field + ".deviceId",
+				Rule:    validation.RuleExists,
+				Message: fmt.Sprintf("device %q does not exist", place.deviceID),
+			})
+		case place.is19Inch && !device.InsertInto19InchCabinet:
+			violations = append(violations, validation.Violation{
+				Field:   place.field + ".deviceId",
+				Rule:    validation.RuleFits,
+				Message: fmt.Sprintf("device %q cannot be inserted into a 19 inch cabinet", place.deviceID),
+			})
+		}
+	}
+	return violations, nil
+}
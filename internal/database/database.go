@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/DerRomtester/testproject-golang-webapi-1/internal/helper"
@@ -22,70 +24,127 @@ const (
 	ErrPingDB            = "error pinging database"
 	ErrNoClient          = "no client connection"
 	ErrDeviceID          = "no device id specified"
+	ErrUserExists        = "user found in db"
+	ErrDeviceExists      = "device already exists"
+	ErrUsernameEmpty     = "username is empty"
+	ErrNotReady          = "database not ready"
+	ErrDeviceTypeExists  = "device type already exists"
+	ErrDeviceTypeInUse   = "device type still has devices"
+	ErrUnknownDeviceType = "unknown device type"
+	ErrProjectExists     = "project already exists"
+	ErrProjectVersion    = "project version does not match"
 )
 
 type DBClient struct {
 	Client *mongo.Client
+	// OperationTimeout bounds every single database operation on top of the
+	// caller's context. Zero means no additional limit.
+	OperationTimeout time.Duration
+	// Names selects the databases and collections, empty names fall back to
+	// DefaultNames.
+	Names Names
+
+	state *connState
 }
 
 type DatabaseConnection struct {
+	Backend  string
+	Path     string
 	User     string
 	Password string
 	Timeout  time.Duration
 	Host     string
 	Port     string
+	Migrate  bool
+	// OperationTimeout is the deadline for a single query or write.
+	OperationTimeout time.Duration
+	// Retry controls how often an unreachable database is pinged again.
+	Retry Backoff
+	// HealthInterval is the time between pings while the database is up.
+	HealthInterval time.Duration
+	// Names selects the databases and collections.
+	Names Names
+
+	// URI is a complete connection string. When it is set Host, Port and the
+	// structured options below must be left empty, only User and Password
+	// may be added to a URI without credentials.
+	URI string
+	// Hosts lists host:port pairs of a replica set or sharded cluster. It
+	// replaces Host and Port.
+	Hosts          []string
+	SRV            bool
+	ReplicaSet     string
+	AuthSource     string
+	TLS            bool
+	TLSCAFile      string
+	TLSInsecure    bool
+	MaxPoolSize    uint64
+	ReadPreference string
 }
 
-func (db DatabaseConnection) GetConnStr() string {
-	if db.User == "" || db.Password == "" {
-		return fmt.Sprintf("mongodb://%s:%s", db.Host, db.Port)
-	} else {
-		return fmt.Sprintf("mongodb://%s:%s@%s:%s", db.User, db.Password, db.Host, db.Port)
+// ConnectDB creates the client without waiting for the database. It pings the
+// server in the background, retrying with backoff until it answers, and keeps
+// checking it afterwards. ClientStatusDB reports ErrNotReady until then.
+func (db DatabaseConnection) ConnectDB() (DBClient, error) {
+	if err := db.Validate(); err != nil {
+		return DBClient{}, err
 	}
-}
 
-func (db DatabaseConnection) ConnectDB() (DBClient, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
 	defer cancel()
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.GetConnStr()))
 
 	if err != nil {
-		log.Fatal(ErrCreateMongoClient)
+		log.Println(ErrCreateMongoClient, ": ", err)
 		return DBClient{}, err
 	}
 
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal(ErrPingDB)
-		return DBClient{}, err
+	mg := DBClient{
+		Client:           client,
+		OperationTimeout: db.OperationTimeout,
+		Names:            db.Names,
+		state:            newConnState(),
 	}
+	go mg.monitor(db)
+	return mg, nil
+}
 
-	log.Println("Connected to db host: ", db.Host, " Port: ", db.Port)
-	return DBClient{Client: client}, nil
+// withTimeout derives the context for a single operation.
+func (mg DBClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if mg.OperationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, mg.OperationTimeout)
 }
 
 func (mg DBClient) ClientStatusDB() error {
 	if mg.Client == nil {
 		return errors.New(ErrNoClient)
 	}
+	if mg.state != nil && !mg.state.ready.Load() {
+		return errors.New(ErrNotReady)
+	}
 	return nil
 }
 
-func (mg DBClient) GetDeviceDB(filter bson.D) (model.Devices, error) {
+func (mg DBClient) GetDeviceDB(ctx context.Context, filter bson.D, opts FindOptions) (model.Devices, error) {
 	var devices model.Devices
 	err := mg.ClientStatusDB()
 	if err != nil {
 		return devices, err
 	}
 
-	collection := mg.Client.Database("devices-db").Collection("Devices")
-	cursor, err := collection.Find(context.Background(), filter)
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.DeviceCollection()
+	cursor, err := collection.Find(ctx, filter, opts.mongo())
 	if err != nil {
 		return devices, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var device model.Device
 		if err := cursor.Decode(&device); err != nil {
 			return devices, err
@@ -100,53 +159,409 @@ func (mg DBClient) GetDeviceDB(filter bson.D) (model.Devices, error) {
 	return devices, nil
 }
 
-func (mg DBClient) DeleteDeviceDB(filter bson.D, deleteMany bool) error {
+func (mg DBClient) DeleteDeviceDB(ctx context.Context, filter bson.D, deleteMany bool) (int64, error) {
 	err := mg.ClientStatusDB()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	collection := mg.Client.Database("devices-db").Collection("Devices")
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.DeviceCollection()
 	if !deleteMany && filter == nil {
 		err := errors.New("device id must be specified")
-		return err
+		return 0, err
 	}
 
-	_, err = collection.DeleteMany(context.TODO(), filter)
+	res, err := collection.DeleteMany(ctx, filter)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return res.DeletedCount, nil
 }
 
-func (mg DBClient) WriteDevicesDB(devices model.Devices) error {
+// SearchDevicesDB uses the text index created by the migrations. The words
+// of text are passed on without the operators of $search.
+func (mg DBClient) SearchDevicesDB(ctx context.Context, text string, limit int64) ([]model.DeviceMatch, error) {
 	err := mg.ClientStatusDB()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	collection := mg.Client.Database("devices-db").Collection("Devices")
-	for _, device := range devices.Devices {
-		filter := bson.D{primitive.E{Key: "_id", Value: device.ID}}
-		var existingDevice model.Device
-		err := collection.FindOne(context.Background(), filter).Decode(&existingDevice)
-		if err == nil {
-			update := bson.D{primitive.E{Key: "$set", Value: bson.M{"name": device.Name}}}
-			_, err := collection.UpdateOne(context.Background(), filter, update)
-			if err != nil {
-				return err
-			}
-		} else {
-			_, err := collection.InsertOne(context.Background(), device)
-			if err != nil {
-				return err
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	score := bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}
+	opts := options.Find().SetProjection(score).SetSort(score)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	filter := bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: strings.Join(terms, " ")}}}}
+	cursor, err := mg.DeviceCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var matches []model.DeviceMatch
+	for cursor.Next(ctx) {
+		var doc struct {
+			model.Device `bson:",inline"`
+			Score        float64 `bson:"score"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		matches = append(matches, model.DeviceMatch{Device: doc.Device, Score: doc.Score})
+	}
+	return matches, cursor.Err()
+}
+
+// SuggestDeviceNamesDB matches an anchored regular expression, which scans
+// the name index instead of the documents.
+func (mg DBClient) SuggestDeviceNamesDB(ctx context.Context, prefix string, limit int64) ([]string, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "name", Value: bson.D{
+			{Key: "$regex", Value: "^" + regexp.QuoteMeta(prefix)},
+			{Key: "$options", Value: "i"},
+		}}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$name"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	cursor, err := mg.DeviceCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var names []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			Name string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		names = append(names, doc.Name)
+	}
+	return names, cursor.Err()
+}
+
+// WriteDevicesDB writes devices with a single BulkWrite and reports the
+// outcome per device, see WriteOptions for the modes. A failing device does
+// not stop the others unless opts.Atomic is set, in which case the batch runs
+// in a transaction.
+func (mg DBClient) WriteDevicesDB(ctx context.Context, devices model.Devices, opts WriteOptions) ([]model.DeviceWriteResult, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	if !opts.Atomic {
+		return mg.writeDevices(ctx, devices.Devices, opts)
+	}
+
+	sess, err := mg.Client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	var results []model.DeviceWriteResult
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var err error
+		results, err = mg.writeDevices(sc, devices.Devices, opts)
+		if err == nil && rejected(results) {
+			return nil, errRollback
+		}
+		return nil, err
+	})
+	if errors.Is(err, errRollback) {
+		return results, nil
+	}
+	return results, err
+}
+
+func (mg DBClient) writeDevices(ctx context.Context, devices []model.Device, opts WriteOptions) ([]model.DeviceWriteResult, error) {
+	collection := mg.DeviceCollection()
+
+	existing := make(map[string]model.Device)
+	if ids := deviceIDs(devices); len(ids) > 0 {
+		found, err := mg.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, FindOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range found.Devices {
+			existing[device.ID] = device
+		}
+	}
+
+	results, writes := planDeviceWrites(devices, existing, opts)
+	if len(writes) == 0 || opts.Atomic && rejected(results) {
+		failWrites(results, writes, nil, opts.Atomic)
+		return results, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(writes))
+	for _, w := range writes {
+		wm, err := deviceWriteModel(w, opts)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, wm)
+	}
+
+	_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(opts.Atomic))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		failed := make(map[int]string, len(bulkErr.WriteErrors))
+		for _, we := range bulkErr.WriteErrors {
+			reason := we.Message
+			if we.HasErrorCode(11000) {
+				reason = ErrDeviceExists
 			}
+			failed[writes[we.Index].result] = reason
 		}
+		failWrites(results, writes, failed, opts.Atomic)
+		return results, nil
+	}
+	return results, err
+}
+
+// deviceWriteModel returns the bulk operation for w. Merges only $set the
+// fields that were sent, so concurrent merges of different fields of the same
+// device do not overwrite each other.
+func deviceWriteModel(w deviceWrite, opts WriteOptions) (mongo.WriteModel, error) {
+	filter := bson.D{{Key: "_id", Value: w.stored.ID}}
+	switch opts.mode() {
+	case model.WriteModeCreate:
+		return mongo.NewInsertOneModel().SetDocument(w.stored), nil
+	case model.WriteModeReplace:
+		return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(w.stored).SetUpsert(true), nil
+	}
+
+	set, onInsert, err := splitKeys(w.stored, deviceKeys(opts.fields(w.result))...)
+	if err != nil {
+		return nil, err
+	}
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(onInsert) > 0 {
+		update = append(update, bson.E{Key: "$setOnInsert", Value: onInsert})
+	}
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true), nil
+}
+
+func (mg DBClient) GetDeviceTypesDB(ctx context.Context, ids []string) ([]model.DeviceType, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{}
+	if ids != nil {
+		filter = bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	}
+	cursor, err := mg.DeviceTypeCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var types []model.DeviceType
+	if err := cursor.All(ctx, &types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+func (mg DBClient) PutDeviceTypeDB(ctx context.Context, t model.DeviceType, create bool) (bool, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.DeviceTypeCollection()
+	if create {
+		_, err := collection.InsertOne(ctx, t)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, errors.New(ErrDeviceTypeExists)
+		}
+		return err == nil, err
+	}
+
+	res, err := collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: t.ID}}, t, options.Replace().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// DeleteDeviceTypeDB runs without a transaction, so a device written with the
+// type while it is being deleted can keep referring to it.
+func (mg DBClient) DeleteDeviceTypeDB(ctx context.Context, id string, opts DeleteTypeOptions) (int64, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	types := mg.DeviceTypeCollection()
+	if err := types.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Err(); err != nil {
+		return 0, err
+	}
+
+	devices := mg.DeviceCollection()
+	ofType := bson.D{{Key: "devicetypeid", Value: id}}
+	var affected int64
+	switch {
+	case opts.Cascade:
+		res, err := devices.DeleteMany(ctx, ofType)
+		if err != nil {
+			return 0, err
+		}
+		affected = res.DeletedCount
+	case opts.Reassign != "":
+		err := types.FindOne(ctx, bson.D{{Key: "_id", Value: opts.Reassign}}).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) || opts.Reassign == id {
+			return 0, fmt.Errorf("%s %q", ErrUnknownDeviceType, opts.Reassign)
+		}
+		if err != nil {
+			return 0, err
+		}
+		res, err := devices.UpdateMany(ctx, ofType, bson.D{{Key: "$set", Value: bson.D{{Key: "devicetypeid", Value: opts.Reassign}}}})
+		if err != nil {
+			return 0, err
+		}
+		affected = res.ModifiedCount
+	default:
+		n, err := devices.CountDocuments(ctx, ofType, options.Count().SetLimit(1))
+		if err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			return 0, errors.New(ErrDeviceTypeInUse)
+		}
+	}
+
+	_, err = types.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return affected, err
+}
+
+func (mg DBClient) GetProjectsDB(ctx context.Context, ids []string) ([]model.Project, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.D{}
+	if ids != nil {
+		filter = bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	}
+	cursor, err := mg.ProjectCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var projects []model.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (mg DBClient) PutProjectDB(ctx context.Context, p model.Project, create bool) (bool, error) {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.ProjectCollection()
+	version := p.Version
+	p.Version++
+	if create {
+		_, err := collection.InsertOne(ctx, p)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, errors.New(ErrProjectExists)
+		}
+		return err == nil, err
+	}
+
+	// Only the expected version is replaced. Projects stored before versions
+	// existed have none and count as version 0. With another version the
+	// filter misses and the upsert collides with the stored project.
+	var match interface{} = version
+	if version == 0 {
+		match = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+	filter := bson.D{{Key: "_id", Value: p.ID}, {Key: "version", Value: match}}
+	res, err := collection.ReplaceOne(ctx, filter, p, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, errors.New(ErrProjectVersion)
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+func (mg DBClient) DeleteProjectDB(ctx context.Context, id string) error {
+	err := mg.ClientStatusDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	res, err := mg.ProjectCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (mg DBClient) CheckUserExists(username string) error {
+func (mg DBClient) CheckUserExists(ctx context.Context, username string) error {
 	var (
 		err          error
 		existingUser model.UserCredentials
@@ -157,44 +572,55 @@ func (mg DBClient) CheckUserExists(username string) error {
 		return err
 	}
 
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
 	if username == "" {
-		return errors.New("username is empty")
+		return errors.New(ErrUsernameEmpty)
 	}
 
-	collection := mg.Client.Database("users-db").Collection("users")
+	collection := mg.UserCollection()
 	filter := bson.D{primitive.E{Key: "username", Value: username}}
-	err = collection.FindOne(context.Background(), filter).Decode(&existingUser)
+	err = collection.FindOne(ctx, filter).Decode(&existingUser)
 
 	if err != nil {
 		return err
 	} else {
-		return errors.New("user found in db")
+		return errors.New(ErrUserExists)
 	}
 }
 
-func (mg DBClient) CreateUserDB(user model.UserCredentials) error {
+func (mg DBClient) CreateUserDB(ctx context.Context, user model.UserCredentials) error {
 	err := mg.ClientStatusDB()
 	if err != nil {
 		return err
 	}
 
-	err = mg.CheckUserExists(user.Username)
-	if err.Error() == "user found in db" {
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	err = mg.CheckUserExists(ctx, user.Username)
+	if err.Error() == ErrUserExists {
 		return err
 	}
 
-	if (err.Error() != "user found in db") && (err.Error() != "mongo: no documents in result") && (err != nil) {
+	if (err.Error() != ErrUserExists) && (err.Error() != "mongo: no documents in result") && (err != nil) {
 		return err
 	}
 
-	collection := mg.Client.Database("users-db").Collection("users")
+	collection := mg.UserCollection()
 	hashedPassword, err := helper.HashPassword(user.Password)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = collection.InsertOne(context.Background(), model.UserCredentials{Username: user.Username, Password: hashedPassword})
+	// The unique index on username closes the race between the lookup above
+	// and this insert.
+	_, err = collection.InsertOne(ctx, model.UserCredentials{Username: user.Username, Password: hashedPassword})
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New(ErrUserExists)
+	}
 	if err != nil {
 		return err
 	}
@@ -202,7 +628,7 @@ func (mg DBClient) CreateUserDB(user model.UserCredentials) error {
 	return nil
 }
 
-func (mg DBClient) GetUserDB(username string) (model.UserCredentials, error) {
+func (mg DBClient) GetUserDB(ctx context.Context, username string) (model.UserCredentials, error) {
 	var (
 		err  error
 		user model.UserCredentials
@@ -214,8 +640,11 @@ func (mg DBClient) GetUserDB(username string) (model.UserCredentials, error) {
 		return user, err
 	}
 
-	collection := mg.Client.Database("users-db").Collection("users")
-	err = collection.FindOne(context.Background(), filter).Decode(&user)
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.UserCollection()
+	err = collection.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return user, err
@@ -225,23 +654,26 @@ func (mg DBClient) GetUserDB(username string) (model.UserCredentials, error) {
 	return user, nil
 }
 
-func (mg DBClient) CreateSessionDB(s session.UserSession) error {
+func (mg DBClient) CreateSessionDB(ctx context.Context, s session.UserSession) error {
 	err := mg.ClientStatusDB()
 	if err != nil {
 		return err
 	}
 
-	collection := mg.Client.Database("users-db").Collection("session")
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.SessionCollection()
 	filter := bson.D{primitive.E{Key: "token", Value: s.Token}}
-	err = collection.FindOne(context.Background(), filter).Decode(s.GetToken())
+	err = collection.FindOne(ctx, filter).Decode(s.GetToken())
 	if err == nil {
 		update := bson.D{primitive.E{Key: "$set", Value: bson.M{"token": s.Token}}}
-		_, err := collection.UpdateOne(context.Background(), filter, update)
+		_, err := collection.UpdateOne(ctx, filter, update)
 		if err != nil {
 			return err
 		}
 	} else {
-		_, err := collection.InsertOne(context.Background(), s)
+		_, err := collection.InsertOne(ctx, s)
 		if err != nil {
 			return err
 		}
@@ -249,7 +681,7 @@ func (mg DBClient) CreateSessionDB(s session.UserSession) error {
 	return nil
 }
 
-func (mg DBClient) GetTokenDB(token string) (session.UserSession, error) {
+func (mg DBClient) GetTokenDB(ctx context.Context, token string) (session.UserSession, error) {
 	var session session.UserSession
 	filter := bson.D{primitive.E{Key: "token", Value: token}}
 	err := mg.ClientStatusDB()
@@ -257,8 +689,11 @@ func (mg DBClient) GetTokenDB(token string) (session.UserSession, error) {
 		return session, err
 	}
 
-	collection := mg.Client.Database("users-db").Collection("session")
-	err = collection.FindOne(context.Background(), filter).Decode(&session)
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.SessionCollection()
+	err = collection.FindOne(ctx, filter).Decode(&session)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return session, err
@@ -268,7 +703,7 @@ func (mg DBClient) GetTokenDB(token string) (session.UserSession, error) {
 	return session, nil
 }
 
-func (mg DBClient) DeleteTokenDB(token string) error {
+func (mg DBClient) DeleteTokenDB(ctx context.Context, token string) error {
 	filter := bson.D{primitive.E{Key: "token", Value: token}}
 
 	err := mg.ClientStatusDB()
@@ -276,8 +711,11 @@ func (mg DBClient) DeleteTokenDB(token string) error {
 		return err
 	}
 
-	collection := mg.Client.Database("users-db").Collection("session")
-	_, err = collection.DeleteOne(context.TODO(), filter)
+	ctx, cancel := mg.withTimeout(ctx)
+	defer cancel()
+
+	collection := mg.SessionCollection()
+	_, err = collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReasonRolledBack is reported for devices of an atomic write that would have
+// succeeded but were rolled back because another device failed.
+const ReasonRolledBack = "rolled back, another device in the batch failed"
+
+// errRollback aborts a transaction after a device of an atomic batch failed.
+var errRollback = errors.New("rollback")
+
+// WriteOptions control how WriteDevicesDB applies a batch.
+type WriteOptions struct {
+	// Atomic applies either every device of the batch or none. On MongoDB
+	// this needs a replica set because it uses a transaction.
+	Atomic bool
+	// Mode is one of model.WriteModeMerge, WriteModeReplace and
+	// WriteModeCreate. Empty means merge.
+	Mode string
+	// Fields holds for every device of the batch the JSON field names that
+	// were sent, merge mode only copies those. A nil Fields or a nil entry
+	// means every field was sent.
+	Fields [][]string
+}
+
+func (o WriteOptions) mode() string {
+	if o.Mode == "" {
+		return model.WriteModeMerge
+	}
+	return o.Mode
+}
+
+func (o WriteOptions) fields(i int) []string {
+	if i >= len(o.Fields) {
+		return nil
+	}
+	return o.Fields[i]
+}
+
+// deviceIDChars are the characters of generated device ids.
+const deviceIDChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// NewDeviceID returns a random 16 character id like 1glmLrTZqf9YZleN for a
+// device that was sent without one.
+func NewDeviceID() string {
+	id := make([]byte, 0, 16)
+	buf := make([]byte, 32)
+	for len(id) < cap(id) {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			// Drop bytes past the last multiple of the alphabet size so
+			// every character is equally likely.
+			if int(b) < 256-256%len(deviceIDChars) && len(id) < cap(id) {
+				id = append(id, deviceIDChars[int(b)%len(deviceIDChars)])
+			}
+		}
+	}
+	return string(id)
+}
+
+// deviceWrite is a device of a batch that needs to be stored.
+type deviceWrite struct {
+	// result is the index in the batch and its result list.
+	result int
+	// stored is the document as it will look after the write.
+	stored model.Device
+}
+
+// planDeviceWrites works out what writing devices does given the currently
+// stored versions in existing. Devices without ID get a generated one. The
+// batch is processed in order, so a device that appears twice is created by
+// its first and updated by its second occurrence.
+func planDeviceWrites(devices []model.Device, existing map[string]model.Device, opts WriteOptions) ([]model.DeviceWriteResult, []deviceWrite) {
+	results := make([]model.DeviceWriteResult, len(devices))
+	writes := make([]deviceWrite, 0, len(devices))
+	current := make(map[string]model.Device, len(existing))
+	for id, device := range existing {
+		current[id] = device
+	}
+
+	mode := opts.mode()
+	for i, device := range devices {
+		if device.ID == "" {
+			device.ID = NewDeviceID()
+		}
+		results[i].ID = device.ID
+		results[i].Mode = mode
+
+		stored, ok := current[device.ID]
+		switch {
+		case !ok:
+			results[i].Status = model.WriteCreated
+			stored = device
+		case mode == model.WriteModeCreate:
+			results[i].Status = model.WriteConflict
+			results[i].Reason = ErrDeviceExists
+			continue
+		default:
+			next := device
+			if mode == model.WriteModeMerge {
+				next = MergeDevice(stored, device, opts.fields(i))
+			}
+			if reflect.DeepEqual(next, stored) {
+				results[i].Status = model.WriteUnchanged
+				continue
+			}
+			results[i].Status = model.WriteUpdated
+			stored = next
+		}
+		current[device.ID] = stored
+		writes = append(writes, deviceWrite{result: i, stored: stored})
+	}
+	return results, writes
+}
+
+// MergeDevice returns stored with the given JSON fields taken from incoming.
+// Names are matched case-insensitively like encoding/json does. Nil fields
+// takes every field.
+func MergeDevice(stored, incoming model.Device, fields []string) model.Device {
+	if fields == nil {
+		return incoming
+	}
+
+	dst := reflect.ValueOf(&stored).Elem()
+	src := reflect.ValueOf(incoming)
+	for i := 0; i < dst.NumField(); i++ {
+		if containsFold(fields, jsonName(dst.Type().Field(i))) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return stored
+}
+
+// deviceKeys returns the document keys of the given JSON fields of a device.
+// Nil fields returns every key.
+func deviceKeys(fields []string) []string {
+	t := reflect.TypeOf(model.Device{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if fields == nil || containsFold(fields, jsonName(f)) {
+			keys = append(keys, bsonName(f))
+		}
+	}
+	return keys
+}
+
+func jsonName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func bsonName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("bson"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceIDs returns the non-empty IDs of devices.
+func deviceIDs(devices []model.Device) []string {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if device.ID != "" {
+			ids = append(ids, device.ID)
+		}
+	}
+	return ids
+}
+
+// failWrites marks the results of failed with their reason. For atomic
+// batches with a rejected device every other planned write is marked as
+// rolled back.
+func failWrites(results []model.DeviceWriteResult, writes []deviceWrite, failed map[int]string, atomic bool) {
+	for i, reason := range failed {
+		results[i].Status = model.WriteFailed
+		if reason == ErrDeviceExists {
+			results[i].Status = model.WriteConflict
+		}
+		results[i].Reason = reason
+	}
+	if !atomic || !rejected(results) {
+		return
+	}
+	for _, w := range writes {
+		if _, ok := failed[w.result]; !ok {
+			results[w.result].Status = model.WriteFailed
+			results[w.result].Reason = ReasonRolledBack
+		}
+	}
+}
+
+// rejected reports whether a device of the batch failed or conflicted.
+func rejected(results []model.DeviceWriteResult) bool {
+	for _, r := range results {
+		if r.Status == model.WriteFailed || r.Status == model.WriteConflict {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeys encodes v as a document and splits it into the top level
+// elements with one of the given keys and the rest. _id is left out of both.
+func splitKeys(v interface{}, keys ...string) (selected, rest bson.D, err error) {
+	doc, err := toDocument(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected, rest = bson.D{}, bson.D{}
+	for _, e := range doc {
+		switch {
+		case e.Key == "_id":
+		case containsFold(keys, e.Key):
+			selected = append(selected, e)
+		default:
+			rest = append(rest, e)
+		}
+	}
+	return selected, rest, nil
+}
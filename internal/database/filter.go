@@ -0,0 +1,339 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matchDocument reports whether doc satisfies a MongoDB query filter. It
+// implements the subset of the query language the API generates so that
+// backends without a query engine behave like MongoDB.
+func matchDocument(raw bson.Raw, filter bson.D) (bool, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return false, err
+	}
+	return matchDoc(doc, filter)
+}
+
+func matchDoc(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchValue encodes v as a document and matches it against filter.
+func matchValue(v interface{}, filter bson.D) (bool, error) {
+	doc, err := bson.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return matchDocument(doc, filter)
+}
+
+// MatchDevice reports whether device matches filter, the same way the memory
+// and SQLite stores select devices.
+func MatchDevice(device model.Device, filter bson.D) (bool, error) {
+	return matchValue(device, filter)
+}
+
+// filterDevices returns the devices that match filter, keeping their order.
+func filterDevices(devices []model.Device, filter bson.D) ([]model.Device, error) {
+	var matched []model.Device
+	for _, device := range devices {
+		ok, err := matchValue(device, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, device)
+		}
+	}
+	return matched, nil
+}
+
+func matchElement(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "":
+		// bson.D{{}} is used throughout the code base as "match everything".
+		return true, nil
+	case "$and", "$or", "$nor":
+		clauses, err := toDocList(e.Value)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", e.Key, err)
+		}
+		return matchLogical(doc, e.Key, clauses)
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("unsupported query operator %s", e.Key)
+	}
+
+	values, exists := lookupPath(doc, e.Key)
+	if cond, ok := toDoc(e.Value); ok && isOperatorDoc(cond) {
+		return matchOperators(values, exists, cond)
+	}
+	return matchEq(values, exists, e.Value), nil
+}
+
+func matchLogical(doc bson.D, op string, clauses []bson.D) (bool, error) {
+	for _, clause := range clauses {
+		ok, err := matchDoc(doc, clause)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !ok:
+			return false, nil
+		case op == "$or" && ok:
+			return true, nil
+		case op == "$nor" && ok:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+func matchOperators(values []interface{}, exists bool, cond bson.D) (bool, error) {
+	for _, c := range cond {
+		var ok bool
+		switch c.Key {
+		case "$eq":
+			ok = matchEq(values, exists, c.Value)
+		case "$ne":
+			ok = !matchEq(values, exists, c.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchCompare(values, c.Key, c.Value)
+		case "$in":
+			list, err := toList(c.Value)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", c.Key, err)
+			}
+			for _, want := range list {
+				if matchEq(values, exists, want) {
+					ok = true
+					break
+				}
+			}
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", c.Key)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchEq(values []interface{}, exists bool, want interface{}) bool {
+	if want == nil {
+		if !exists {
+			return true
+		}
+		for _, v := range values {
+			if v == nil {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range values {
+		if c, ok := compareValues(v, want); ok && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []interface{}, op string, want interface{}) bool {
+	for _, v := range values {
+		c, ok := compareValues(v, want)
+		if !ok {
+			continue
+		}
+		switch {
+		case op == "$gt" && c > 0, op == "$gte" && c >= 0,
+			op == "$lt" && c < 0, op == "$lte" && c <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPath resolves a dotted path in doc. Arrays along the way are
+// flattened the same way MongoDB does when it matches array fields.
+func lookupPath(doc bson.D, path string) ([]interface{}, bool) {
+	current := []interface{}{doc}
+
+	for _, part := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, v := range current {
+			for _, item := range flatten(v) {
+				d, ok := toDoc(item)
+				if !ok {
+					continue
+				}
+				for _, e := range d {
+					if e.Key == part {
+						next = append(next, normalize(e.Value))
+					}
+				}
+			}
+		}
+		if len(next) == 0 {
+			return nil, false
+		}
+		current = next
+	}
+
+	var values []interface{}
+	for _, v := range current {
+		values = append(values, v)
+		if arr, ok := v.([]interface{}); ok {
+			values = append(values, arr...)
+		}
+	}
+	return values, true
+}
+
+func flatten(v interface{}) []interface{} {
+	if arr, ok := v.([]interface{}); ok {
+		return arr
+	}
+	return []interface{}{v}
+}
+
+// normalize converts decoded BSON values to a small set of Go types so that
+// they can be compared regardless of how they were encoded.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case uint:
+		return float64(t)
+	case primitive.ObjectID:
+		return t.Hex()
+	case primitive.A:
+		out := make([]interface{}, len(t))
+		for i := range t {
+			out[i] = normalize(t[i])
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i := range t {
+			out[i] = normalize(t[i])
+		}
+		return out
+	}
+	return v
+}
+
+// compareValues orders two values of the same BSON type bracket. The second
+// result is false when the values cannot be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	a, b = normalize(a), normalize(b)
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func isOperatorDoc(d bson.D) bool {
+	return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+func toDoc(v interface{}) (bson.D, bool) {
+	switch t := v.(type) {
+	case bson.D:
+		return t, true
+	case bson.M:
+		return mapToDoc(t), true
+	case map[string]interface{}:
+		return mapToDoc(t), true
+	}
+	return nil, false
+}
+
+func mapToDoc(m map[string]interface{}) bson.D {
+	d := make(bson.D, 0, len(m))
+	for k, v := range m {
+		d = append(d, bson.E{Key: k, Value: v})
+	}
+	return d
+}
+
+func toList(v interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected an array")
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, nil
+}
+
+func toDocList(v interface{}) ([]bson.D, error) {
+	list, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]bson.D, 0, len(list))
+	for _, item := range list {
+		d, ok := toDoc(item)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of documents")
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOptions control the order and size of the result of GetDeviceDB.
+type FindOptions struct {
+	// Sort orders the result like a MongoDB sort document, for example
+	// bson.D{{Key: "_id", Value: 1}}. Without Sort the order is up to the
+	// backend.
+	Sort bson.D
+	// Limit caps the number of returned devices, zero means no limit.
+	Limit int64
+	// Projection lists the document keys to fetch, the other fields of the
+	// returned devices are left empty. The id is always fetched. Nil fetches
+	// every field.
+	Projection []string
+}
+
+func (o FindOptions) mongo() *options.FindOptions {
+	opts := options.Find()
+	if len(o.Sort) > 0 {
+		opts.SetSort(o.Sort)
+	}
+	if o.Limit > 0 {
+		opts.SetLimit(o.Limit)
+	}
+	if o.Projection != nil {
+		projection := bson.D{}
+		for _, key := range o.Projection {
+			projection = append(projection, bson.E{Key: key, Value: 1})
+		}
+		opts.SetProjection(projection)
+	}
+	return opts
+}
+
+// apply sorts and limits devices in Go for backends without a query engine.
+// Missing fields sort before every value, like in MongoDB.
+func (o FindOptions) apply(devices []model.Device) ([]model.Device, error) {
+	if len(o.Sort) > 0 {
+		docs := make(map[string]bson.D, len(devices))
+		for _, device := range devices {
+			doc, err := toDocument(device)
+			if err != nil {
+				return nil, err
+			}
+			docs[device.ID] = doc
+		}
+		sort.SliceStable(devices, func(i, j int) bool {
+			return compareSorted(docs[devices[i].ID], docs[devices[j].ID], o.Sort) < 0
+		})
+	}
+	if o.Limit > 0 && int64(len(devices)) > o.Limit {
+		devices = devices[:o.Limit]
+	}
+	if o.Projection != nil {
+		for i := range devices {
+			devices[i] = project(devices[i], o.Projection)
+		}
+	}
+	return devices, nil
+}
+
+// project returns device with only the fields of keys and the id set.
+func project(device model.Device, keys []string) model.Device {
+	v := reflect.ValueOf(&device).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := bsonName(v.Type().Field(i))
+		if key != "_id" && !containsFold(keys, key) {
+			v.Field(i).SetZero()
+		}
+	}
+	return device
+}
+
+func toDocument(v interface{}) (bson.D, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	return doc, bson.Unmarshal(raw, &doc)
+}
+
+// compareSorted compares two documents by the keys of a sort document.
+func compareSorted(a, b bson.D, sortDoc bson.D) int {
+	for _, e := range sortDoc {
+		c := compareSortKey(a, b, e.Key)
+		if direction, ok := normalize(e.Value).(float64); ok && direction < 0 {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareSortKey(a, b bson.D, key string) int {
+	av, aok := lookupPath(a, key)
+	bv, bok := lookupPath(b, key)
+	switch {
+	case !aok || len(av) == 0:
+		if !bok || len(bv) == 0 {
+			return 0
+		}
+		return -1
+	case !bok || len(bv) == 0:
+		return 1
+	}
+	c, _ := compareValues(av[0], bv[0])
+	return c
+}
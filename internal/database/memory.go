@@ -0,0 +1,414 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/helper"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemoryStore is a thread-safe Store that keeps everything in process
+// memory. It is meant for tests and local development.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	devices  map[string]model.Device
+	types    map[string]model.DeviceType
+	projects map[string]model.Project
+	users    map[string]model.UserCredentials
+	sessions map[string]session.UserSession
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		devices:  make(map[string]model.Device),
+		types:    make(map[string]model.DeviceType),
+		projects: make(map[string]model.Project),
+		users:    make(map[string]model.UserCredentials),
+		sessions: make(map[string]session.UserSession),
+	}
+}
+
+func (m *MemoryStore) ClientStatusDB() error {
+	if m == nil {
+		return errors.New(ErrNoClient)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetDeviceDB(ctx context.Context, filter bson.D, opts FindOptions) (model.Devices, error) {
+	var devices model.Devices
+	if err := ctx.Err(); err != nil {
+		return devices, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched, err := filterDevices(m.sortedDevices(), filter)
+	if err != nil {
+		return devices, err
+	}
+	devices.Devices, err = opts.apply(matched)
+	return devices, err
+}
+
+// sortedDevices returns copies of all devices ordered by id, so callers may
+// change them. The caller must hold mu.
+func (m *MemoryStore) sortedDevices() []model.Device {
+	list := make([]model.Device, 0, len(m.devices))
+	for _, device := range m.devices {
+		list = append(list, cloneDevice(device))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (m *MemoryStore) SearchDevicesDB(ctx context.Context, text string, limit int64) ([]model.DeviceMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return searchDevices(m.sortedDevices(), text, limit), nil
+}
+
+func (m *MemoryStore) SuggestDeviceNamesDB(ctx context.Context, prefix string, limit int64) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return suggestNames(m.sortedDevices(), prefix, limit), nil
+}
+
+func (m *MemoryStore) DeleteDeviceDB(ctx context.Context, filter bson.D, deleteMany bool) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if !deleteMany && filter == nil {
+		return 0, errors.New("device id must be specified")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, device := range m.devices {
+		ok, err := matchValue(device, filter)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			delete(m.devices, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// WriteDevicesDB applies the whole batch under one lock, so other writers
+// never see a partially written atomic batch.
+func (m *MemoryStore) WriteDevicesDB(ctx context.Context, devices model.Devices, opts WriteOptions) ([]model.DeviceWriteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results, writes := planDeviceWrites(devices.Devices, m.devices, opts)
+	if opts.Atomic && rejected(results) {
+		failWrites(results, writes, nil, true)
+		return results, nil
+	}
+	for _, w := range writes {
+		m.devices[w.stored.ID] = cloneDevice(w.stored)
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) GetDeviceTypesDB(ctx context.Context, ids []string) ([]model.DeviceType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var types []model.DeviceType
+	for id, t := range m.types {
+		if ids == nil || containsString(ids, id) {
+			types = append(types, cloneDeviceType(t))
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].ID < types[j].ID })
+	return types, nil
+}
+
+func (m *MemoryStore) PutDeviceTypeDB(ctx context.Context, t model.DeviceType, create bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.types[t.ID]
+	if exists && create {
+		return false, errors.New(ErrDeviceTypeExists)
+	}
+	m.types[t.ID] = cloneDeviceType(t)
+	return !exists, nil
+}
+
+// DeleteDeviceTypeDB checks, moves or deletes the devices and deletes the
+// type under one lock.
+func (m *MemoryStore) DeleteDeviceTypeDB(ctx context.Context, id string, opts DeleteTypeOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.types[id]; !ok {
+		return 0, ErrNotFound
+	}
+	if _, ok := m.types[opts.Reassign]; opts.Reassign != "" && (!ok || opts.Reassign == id) {
+		return 0, fmt.Errorf("%s %q", ErrUnknownDeviceType, opts.Reassign)
+	}
+
+	var affected int64
+	for deviceID, device := range m.devices {
+		if device.DeviceTypeID != id {
+			continue
+		}
+		switch {
+		case opts.Cascade:
+			delete(m.devices, deviceID)
+		case opts.Reassign != "":
+			device.DeviceTypeID = opts.Reassign
+			m.devices[deviceID] = device
+		default:
+			return 0, errors.New(ErrDeviceTypeInUse)
+		}
+		affected++
+	}
+	delete(m.types, id)
+	return affected, nil
+}
+
+func (m *MemoryStore) GetProjectsDB(ctx context.Context, ids []string) ([]model.Project, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var projects []model.Project
+	for id, p := range m.projects {
+		if ids == nil || containsString(ids, id) {
+			projects = append(projects, cloneProject(p))
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	return projects, nil
+}
+
+func (m *MemoryStore) PutProjectDB(ctx context.Context, p model.Project, create bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.projects[p.ID]
+	switch {
+	case exists && create:
+		return false, errors.New(ErrProjectExists)
+	case exists && stored.Version != p.Version:
+		return false, errors.New(ErrProjectVersion)
+	}
+	p.Version++
+	m.projects[p.ID] = cloneProject(p)
+	return !exists, nil
+}
+
+func (m *MemoryStore) DeleteProjectDB(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.projects, id)
+	return nil
+}
+
+// cloneDevice copies the attributes of d including nested objects and
+// arrays, so the stored device shares nothing with the caller.
+func cloneDevice(d model.Device) model.Device {
+	if d.Attributes != nil {
+		d.Attributes = cloneValue(d.Attributes).(map[string]interface{})
+	}
+	return d
+}
+
+// cloneDeviceType copies the defaults of t including nested values and its
+// attributes schema, so the stored type shares nothing with the caller.
+func cloneDeviceType(t model.DeviceType) model.DeviceType {
+	if t.Defaults != nil {
+		t.Defaults = cloneValue(t.Defaults).(map[string]interface{})
+	}
+	t.AttributesSchema = bytes.Clone(t.AttributesSchema)
+	return t
+}
+
+// cloneValue deep-copies the maps and slices of a decoded JSON or BSON value.
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = cloneValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = cloneValue(value)
+		}
+		return out
+	case bson.M:
+		return cloneValue(map[string]interface{}(v))
+	case bson.A:
+		return cloneValue([]interface{}(v))
+	case bson.D:
+		out := make(bson.D, len(v))
+		for i, e := range v {
+			out[i] = bson.E{Key: e.Key, Value: cloneValue(e.Value)}
+		}
+		return out
+	}
+	return v
+}
+
+// cloneProject copies the cabinets, racks and slots of p so callers cannot
+// change the stored project.
+func cloneProject(p model.Project) model.Project {
+	p.Cabinets = slices.Clone(p.Cabinets)
+	for i := range p.Cabinets {
+		p.Cabinets[i].Racks = slices.Clone(p.Cabinets[i].Racks)
+		for j := range p.Cabinets[i].Racks {
+			p.Cabinets[i].Racks[j].Slots = slices.Clone(p.Cabinets[i].Racks[j].Slots)
+		}
+	}
+	return p
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) CreateUserDB(ctx context.Context, user model.UserCredentials) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if user.Username == "" {
+		return errors.New(ErrUsernameEmpty)
+	}
+
+	hashedPassword, err := helper.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Username]; ok {
+		return errors.New(ErrUserExists)
+	}
+	m.users[user.Username] = model.UserCredentials{Username: user.Username, Password: hashedPassword}
+	return nil
+}
+
+func (m *MemoryStore) GetUserDB(ctx context.Context, username string) (model.UserCredentials, error) {
+	if err := ctx.Err(); err != nil {
+		return model.UserCredentials{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return model.UserCredentials{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) CreateSessionDB(ctx context.Context, s session.UserSession) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.Token] = s
+	return nil
+}
+
+func (m *MemoryStore) GetTokenDB(ctx context.Context, token string) (session.UserSession, error) {
+	if err := ctx.Err(); err != nil {
+		return session.UserSession{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[token]
+	if !ok {
+		return session.UserSession{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) DeleteTokenDB(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+	return nil
+}
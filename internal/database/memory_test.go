@@ -0,0 +1,460 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ctx = context.Background()
+
+var testDevices = model.Devices{Devices: []model.Device{
+	{ID: "a", Name: "S7-1500", Failsafe: true, TempMin: -25, TempMax: 70},
+	{ID: "b", Name: "ET 200SP", TempMin: 0, TempMax: 60},
+	{ID: "c", Name: "S7-1200", Failsafe: true, TempMin: 0, TempMax: 55},
+}}
+
+// writeDevices writes devices with opts and fails the test on a store error.
+func writeDevices(t *testing.T, store database.DeviceStore, devices model.Devices, opts database.WriteOptions) []model.DeviceWriteResult {
+	t.Helper()
+	results, err := store.WriteDevicesDB(ctx, devices, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func testGetDeviceFilter(t *testing.T, store database.DeviceStore) {
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+
+	all, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, all.Devices, 3)
+
+	filtered, err := store.GetDeviceDB(ctx, bson.D{
+		{Key: "failsafe", Value: true},
+		{Key: "tempmax", Value: bson.D{{Key: "$gte", Value: 60}}},
+	}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, filtered.Devices, 1)
+	assert.Equal(t, "a", filtered.Devices[0].ID)
+
+	either, err := store.GetDeviceDB(ctx, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "_id", Value: "b"}},
+		bson.D{{Key: "tempmin", Value: bson.D{{Key: "$lt", Value: 0}}}},
+	}}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, either.Devices, 2)
+
+	listed, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A{"a", "c", "x"}}}}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, listed.Devices, 2)
+
+	after, err := store.GetDeviceDB(ctx, bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "failsafe", Value: true}},
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: "a"}}}},
+	}}}, database.FindOptions{})
+	assert.Nil(t, err)
+	if assert.Len(t, after.Devices, 1) {
+		assert.Equal(t, "c", after.Devices[0].ID)
+	}
+
+	neither, err := store.GetDeviceDB(ctx, bson.D{{Key: "$nor", Value: bson.A{
+		bson.D{{Key: "_id", Value: "a"}},
+		bson.D{{Key: "tempmax", Value: bson.D{{Key: "$lt", Value: 60}}}},
+	}}}, database.FindOptions{})
+	assert.Nil(t, err)
+	if assert.Len(t, neither.Devices, 1) {
+		assert.Equal(t, "b", neither.Devices[0].ID)
+	}
+
+	_, err = store.GetDeviceDB(ctx, bson.D{{Key: "tempmax", Value: bson.D{{Key: "$exists", Value: true}}}}, database.FindOptions{})
+	assert.EqualError(t, err, "unsupported query operator $exists")
+}
+
+func TestMemoryStoreGetDeviceFilter(t *testing.T) {
+	testGetDeviceFilter(t, database.NewMemoryStore())
+}
+
+// rename only sends the id and name of device b.
+var rename = model.Devices{Devices: []model.Device{{ID: "b", Name: "renamed"}}}
+var renameFields = [][]string{{"id", "name"}}
+
+func testGetDeviceSortAndLimit(t *testing.T, store database.DeviceStore) {
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{
+		Sort:  bson.D{{Key: "tempmax", Value: -1}, {Key: "_id", Value: 1}},
+		Limit: 2,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, got.Devices, 2)
+	assert.Equal(t, "a", got.Devices[0].ID)
+	assert.Equal(t, "b", got.Devices[1].ID)
+
+	// The limit applies after filters matched in Go.
+	got, err = store.GetDeviceDB(ctx, bson.D{{Key: "$nor", Value: bson.A{
+		bson.D{{Key: "_id", Value: "a"}},
+	}}}, database.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: 1})
+	assert.Nil(t, err)
+	if assert.Len(t, got.Devices, 1) {
+		assert.Equal(t, "b", got.Devices[0].ID)
+	}
+
+	// A keyset page continues after the last id of the previous one.
+	got, err = store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: "a"}}}}, database.FindOptions{
+		Sort:  bson.D{{Key: "_id", Value: 1}},
+		Limit: 1,
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, got.Devices, 1) {
+		assert.Equal(t, "b", got.Devices[0].ID)
+	}
+}
+
+func TestMemoryStoreGetDeviceSortAndLimit(t *testing.T) {
+	testGetDeviceSortAndLimit(t, database.NewMemoryStore())
+}
+
+func TestMemoryStoreGetDeviceProjection(t *testing.T) {
+	store := database.NewMemoryStore()
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "a"}}, database.FindOptions{Projection: []string{"name", "tempmax"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Device{{ID: "a", Name: "S7-1500", TempMax: 70}}, got.Devices)
+
+	got, err = store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "a"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, testDevices.Devices[0], got.Devices[0], "projection should not touch the stored device")
+}
+
+func TestMemoryStoreWriteMergesSentFields(t *testing.T) {
+	store := database.NewMemoryStore()
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+	writeDevices(t, store, rename, database.WriteOptions{Fields: renameFields})
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "b"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", got.Devices[0].Name)
+	assert.Equal(t, 60, got.Devices[0].TempMax)
+}
+
+func TestMemoryStoreWriteGeneratesIDs(t *testing.T) {
+	store := database.NewMemoryStore()
+	results := writeDevices(t, store, model.Devices{Devices: []model.Device{{Name: "S7-1500"}, {Name: "S7-1200"}}}, database.WriteOptions{})
+	assert.Regexp(t, `^[0-9A-Za-z]{16}$`, results[0].ID)
+	assert.NotEqual(t, results[0].ID, results[1].ID)
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: results[0].ID}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, got.Devices, 1)
+}
+
+func TestMemoryStoreWriteResults(t *testing.T) {
+	store := database.NewMemoryStore()
+	results := writeDevices(t, store, testDevices, database.WriteOptions{})
+	for _, r := range results {
+		assert.Equal(t, model.WriteCreated, r.Status)
+	}
+
+	results = writeDevices(t, store, model.Devices{Devices: []model.Device{
+		testDevices.Devices[0],
+		{ID: "b", Name: "renamed"},
+		{Name: "generated"},
+	}}, database.WriteOptions{})
+	assert.Equal(t, []string{model.WriteUnchanged, model.WriteUpdated, model.WriteCreated},
+		[]string{results[0].Status, results[1].Status, results[2].Status})
+	assert.Equal(t, model.WriteModeMerge, results[0].Mode)
+	assert.NotEmpty(t, results[2].ID, "devices without ID should get a generated one")
+}
+
+func TestMemoryStoreWriteReplace(t *testing.T) {
+	store := database.NewMemoryStore()
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+	results := writeDevices(t, store, rename, database.WriteOptions{Mode: model.WriteModeReplace, Fields: renameFields})
+	assert.Equal(t, model.WriteUpdated, results[0].Status)
+	assert.Equal(t, model.WriteModeReplace, results[0].Mode)
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "b"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, rename.Devices[0], got.Devices[0], "fields that were not sent should be cleared")
+}
+
+func TestMemoryStoreWriteCreateOnly(t *testing.T) {
+	store := database.NewMemoryStore()
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+
+	batch := model.Devices{Devices: []model.Device{rename.Devices[0], {ID: "d", Name: "new"}}}
+	results := writeDevices(t, store, batch, database.WriteOptions{Mode: model.WriteModeCreate, Atomic: true})
+	assert.Equal(t, model.WriteConflict, results[0].Status)
+	assert.Equal(t, database.ErrDeviceExists, results[0].Reason)
+	assert.Equal(t, database.ReasonRolledBack, results[1].Reason)
+
+	results = writeDevices(t, store, batch, database.WriteOptions{Mode: model.WriteModeCreate})
+	assert.Equal(t, model.WriteConflict, results[0].Status)
+	assert.Equal(t, model.WriteCreated, results[1].Status)
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "b"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, testDevices.Devices[1], got.Devices[0], "create should not touch existing devices")
+}
+
+func TestMemoryStoreDeleteDevice(t *testing.T) {
+	store := database.NewMemoryStore()
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+	deleted, err := store.DeleteDeviceDB(ctx, bson.D{{Key: "_id", Value: "a"}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, got.Devices, 2)
+}
+
+func TestMemoryStoreUsersAndSessions(t *testing.T) {
+	store := database.NewMemoryStore()
+	creds := model.UserCredentials{Username: "TestUser", Password: "secret"}
+	assert.Nil(t, store.CreateUserDB(ctx, creds))
+	assert.NotNil(t, store.CreateUserDB(ctx, creds), "creating a user twice should fail")
+
+	user, err := store.GetUserDB(ctx, "TestUser")
+	assert.Nil(t, err)
+	assert.NotEqual(t, creds.Password, user.Password, "password should be stored hashed")
+
+	s := session.UserSession{Username: "TestUser", Token: "token"}
+	assert.Nil(t, store.CreateSessionDB(ctx, s))
+	got, err := store.GetTokenDB(ctx, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, "TestUser", got.Username)
+
+	assert.Nil(t, store.DeleteTokenDB(ctx, "token"))
+	_, err = store.GetTokenDB(ctx, "token")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestMemoryStoreCanceledContext(t *testing.T) {
+	store := database.NewMemoryStore()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := store.GetDeviceDB(canceled, bson.D{{}}, database.FindOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+var searchableDevices = model.Devices{Devices: []model.Device{
+	{ID: "a", Name: "S7-1500 CPU", DeviceTypeID: "CPU"},
+	{ID: "b", Name: "ET 200SP", DeviceTypeID: "CPU"},
+	{ID: "c", Name: "ET 200MP", DeviceTypeID: "IO"},
+	{ID: "d", Name: "S7-1200", DeviceTypeID: "CPU"},
+}}
+
+// testSearch checks that store ranks name matches above device type matches
+// and completes names from their first characters.
+func testSearch(t *testing.T, store database.DeviceStore) {
+	t.Helper()
+	writeDevices(t, store, searchableDevices, database.WriteOptions{})
+
+	matches, err := store.SearchDevicesDB(ctx, "cpu", 0)
+	assert.Nil(t, err)
+	if assert.Len(t, matches, 3) {
+		assert.Equal(t, "a", matches[0].Device.ID)
+		assert.Greater(t, matches[0].Score, matches[1].Score)
+	}
+
+	matches, err = store.SearchDevicesDB(ctx, "et 200mp", 1)
+	assert.Nil(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "c", matches[0].Device.ID)
+	}
+
+	names, err := store.SuggestDeviceNamesDB(ctx, "s7", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"S7-1200", "S7-1500 CPU"}, names)
+
+	names, err = store.SuggestDeviceNamesDB(ctx, "et", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ET 200MP"}, names)
+
+	names, err = store.SuggestDeviceNamesDB(ctx, "e_", 0)
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+}
+
+func TestMemoryStoreSearch(t *testing.T) {
+	testSearch(t, database.NewMemoryStore())
+}
+
+// testDeviceTypes checks that store keeps device types and only deletes types
+// with devices when told what to do with them.
+func testDeviceTypes(t *testing.T, store database.Store) {
+	t.Helper()
+	for _, id := range []string{"cpu", "io", "hmi"} {
+		created, err := store.PutDeviceTypeDB(ctx, model.DeviceType{ID: id, Name: id, Defaults: map[string]interface{}{"failsafe": true}}, true)
+		assert.Nil(t, err)
+		assert.True(t, created)
+	}
+	_, err := store.PutDeviceTypeDB(ctx, model.DeviceType{ID: "cpu"}, true)
+	assert.EqualError(t, err, database.ErrDeviceTypeExists)
+	created, err := store.PutDeviceTypeDB(ctx, model.DeviceType{ID: "cpu", Name: "CPU"}, false)
+	assert.Nil(t, err)
+	assert.False(t, created)
+
+	types, err := store.GetDeviceTypesDB(ctx, []string{"io", "cpu", "plc"})
+	assert.Nil(t, err)
+	assert.Equal(t, []model.DeviceType{
+		{ID: "cpu", Name: "CPU"},
+		{ID: "io", Name: "io", Defaults: map[string]interface{}{"failsafe": true}},
+	}, types)
+
+	writeDevices(t, store, model.Devices{Devices: []model.Device{
+		{ID: "a", DeviceTypeID: "cpu"},
+		{ID: "b", DeviceTypeID: "cpu"},
+		{ID: "c", DeviceTypeID: "io"},
+	}}, database.WriteOptions{})
+
+	_, err = store.DeleteDeviceTypeDB(ctx, "cpu", database.DeleteTypeOptions{})
+	assert.EqualError(t, err, database.ErrDeviceTypeInUse)
+	_, err = store.DeleteDeviceTypeDB(ctx, "cpu", database.DeleteTypeOptions{Reassign: "plc"})
+	assert.EqualError(t, err, database.ErrUnknownDeviceType+` "plc"`)
+	_, err = store.DeleteDeviceTypeDB(ctx, "plc", database.DeleteTypeOptions{})
+	assert.ErrorIs(t, err, database.ErrNotFound)
+
+	moved, err := store.DeleteDeviceTypeDB(ctx, "cpu", database.DeleteTypeOptions{Reassign: "hmi"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), moved)
+	deleted, err := store.DeleteDeviceTypeDB(ctx, "io", database.DeleteTypeOptions{Cascade: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+	unused, err := store.DeleteDeviceTypeDB(ctx, "hmi", database.DeleteTypeOptions{Cascade: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), unused)
+
+	devices, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, devices.Devices)
+	types, err = store.GetDeviceTypesDB(ctx, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, types)
+}
+
+func TestMemoryStoreDeviceTypes(t *testing.T) {
+	testDeviceTypes(t, database.NewMemoryStore())
+}
+
+func testAttributes(t *testing.T, store database.Store) {
+	t.Helper()
+	schema := json.RawMessage(`{"properties":{"ports":{"type":"integer"}}}`)
+	defaults := map[string]interface{}{"attributes": map[string]interface{}{"ports": 8.0}}
+	_, err := store.PutDeviceTypeDB(ctx, model.DeviceType{ID: "switch", Name: "Switch", Defaults: defaults, AttributesSchema: schema}, true)
+	assert.Nil(t, err)
+	types, err := store.GetDeviceTypesDB(ctx, []string{"switch"})
+	assert.Nil(t, err)
+	want := model.DeviceType{
+		ID: "switch", Name: "Switch",
+		Defaults:         map[string]interface{}{"attributes": map[string]interface{}{"ports": 8.0}},
+		AttributesSchema: json.RawMessage(`{"properties":{"ports":{"type":"integer"}}}`),
+	}
+	assert.Equal(t, []model.DeviceType{want}, types)
+
+	// Neither the written nor a read type shares its defaults or schema
+	// with the stored one.
+	defaults["attributes"].(map[string]interface{})["ports"] = 16.0
+	schema[0] = ' '
+	if assert.Len(t, types, 1) {
+		types[0].Defaults["attributes"].(map[string]interface{})["ports"] = 24.0
+		types[0].AttributesSchema[1] = ' '
+	}
+	types, err = store.GetDeviceTypesDB(ctx, []string{"switch"})
+	assert.Nil(t, err)
+	assert.Equal(t, []model.DeviceType{want}, types)
+
+	vendor := map[string]interface{}{"code": "SI"}
+	writeDevices(t, store, model.Devices{Devices: []model.Device{
+		{ID: "a", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 8.0, "vendor": vendor}},
+		{ID: "b", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 24.0}},
+		{ID: "c"},
+	}}, database.WriteOptions{})
+
+	devices, err := store.GetDeviceDB(ctx, bson.D{{Key: "attributes.ports", Value: bson.D{{Key: "$gte", Value: 10}}}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Device{{ID: "b", DeviceTypeID: "switch", Attributes: map[string]interface{}{"ports": 24.0}}}, devices.Devices)
+	devices, err = store.GetDeviceDB(ctx, bson.D{{Key: "attributes.vendor.code", Value: "SI"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	if assert.Len(t, devices.Devices, 1) {
+		assert.Equal(t, "a", devices.Devices[0].ID)
+		devices.Devices[0].Attributes["vendor"].(map[string]interface{})["code"] = "read"
+	}
+
+	// Neither the written nor a read device shares nested values with the
+	// stored one.
+	vendor["code"] = "written"
+	devices, err = store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "a"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	if assert.Len(t, devices.Devices, 1) {
+		assert.Equal(t, map[string]interface{}{"code": "SI"}, devices.Devices[0].Attributes["vendor"])
+	}
+}
+
+func TestMemoryStoreAttributes(t *testing.T) {
+	testAttributes(t, database.NewMemoryStore())
+}
+
+func testProjects(t *testing.T, store database.Store) {
+	t.Helper()
+	project := model.Project{ID: "line-1", Name: "Line 1", Cabinets: []model.Cabinet{{
+		ID: "main", Is19Inch: true,
+		Racks: []model.Rack{{ID: "r1", SlotCount: 8, Slots: []model.Slot{{Number: 1, DeviceID: "a"}}}},
+	}}}
+	created, err := store.PutProjectDB(ctx, project, true)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	_, err = store.PutProjectDB(ctx, project, true)
+	assert.EqualError(t, err, database.ErrProjectExists)
+	created, err = store.PutProjectDB(ctx, model.Project{ID: "hall", Name: "Hall"}, false)
+	assert.Nil(t, err)
+	assert.True(t, created)
+
+	// Changing the written project must not change the stored one.
+	project.Cabinets[0].Racks[0].Slots[0].DeviceID = "b"
+	projects, err := store.GetProjectsDB(ctx, []string{"line-1", "x"})
+	assert.Nil(t, err)
+	if assert.Len(t, projects, 1) {
+		assert.Equal(t, "a", projects[0].Cabinets[0].Racks[0].Slots[0].DeviceID)
+		assert.True(t, projects[0].Cabinets[0].Is19Inch)
+		assert.Equal(t, 1, projects[0].Version)
+	}
+
+	// A replacement has to be based on the stored version, so the second of
+	// two replacements based on the same version fails.
+	_, err = store.PutProjectDB(ctx, project, false)
+	assert.EqualError(t, err, database.ErrProjectVersion)
+	project.Version = 1
+	created, err = store.PutProjectDB(ctx, project, false)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	_, err = store.PutProjectDB(ctx, project, false)
+	assert.EqualError(t, err, database.ErrProjectVersion)
+	projects, err = store.GetProjectsDB(ctx, []string{"line-1"})
+	assert.Nil(t, err)
+	if assert.Len(t, projects, 1) {
+		assert.Equal(t, 2, projects[0].Version)
+		assert.Equal(t, "b", projects[0].Cabinets[0].Racks[0].Slots[0].DeviceID)
+	}
+
+	assert.Nil(t, store.DeleteProjectDB(ctx, "line-1"))
+	assert.ErrorIs(t, store.DeleteProjectDB(ctx, "line-1"), database.ErrNotFound)
+	projects, err = store.GetProjectsDB(ctx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Project{{ID: "hall", Name: "Hall", Version: 1}}, projects)
+}
+
+func TestMemoryStoreProjects(t *testing.T) {
+	testProjects(t, database.NewMemoryStore())
+}
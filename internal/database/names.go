@@ -0,0 +1,101 @@
+package database
+
+import (
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Names are the MongoDB database and collection names a DBClient works on.
+// Prefix is prepended to both database names so several instances, e.g.
+// staging and test tenants, can share one cluster.
+type Names struct {
+	Prefix               string
+	DeviceDatabase       string
+	DeviceCollection     string
+	DeviceTypeCollection string
+	ProjectCollection    string
+	UserDatabase         string
+	UserCollection       string
+	SessionCollection    string
+	MigrationCollection  string
+}
+
+// DefaultNames are the names used before they became configurable.
+func DefaultNames() Names {
+	return Names{
+		DeviceDatabase:       "devices-db",
+		DeviceCollection:     "Devices",
+		DeviceTypeCollection: "DeviceTypes",
+		ProjectCollection:    "Projects",
+		UserDatabase:         "users-db",
+		UserCollection:       "users",
+		SessionCollection:    "session",
+		MigrationCollection:  "migrations",
+	}
+}
+
+// WithDefaults fills every empty name with its default.
+func (n Names) WithDefaults() Names {
+	d := DefaultNames()
+	for _, f := range []struct{ v, def *string }{
+		{&n.DeviceDatabase, &d.DeviceDatabase},
+		{&n.DeviceCollection, &d.DeviceCollection},
+		{&n.DeviceTypeCollection, &d.DeviceTypeCollection},
+		{&n.ProjectCollection, &d.ProjectCollection},
+		{&n.UserDatabase, &d.UserDatabase},
+		{&n.UserCollection, &d.UserCollection},
+		{&n.SessionCollection, &d.SessionCollection},
+		{&n.MigrationCollection, &d.MigrationCollection},
+	} {
+		if *f.v == "" {
+			*f.v = *f.def
+		}
+	}
+	return n
+}
+
+func (mg DBClient) names() Names {
+	return mg.Names.WithDefaults()
+}
+
+// deviceDocuments decodes nested documents like device attributes to maps,
+// which encode to JSON objects, instead of bson.D. Only the collections
+// holding device fields use it.
+func deviceDocuments() *options.CollectionOptions {
+	return options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+}
+
+func (mg DBClient) DeviceCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix+n.DeviceDatabase).Collection(n.DeviceCollection, deviceDocuments())
+}
+
+// DeviceTypeCollection holds the device types, next to the devices. Their
+// defaults are device fields and may hold attributes.
+func (mg DBClient) DeviceTypeCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix+n.DeviceDatabase).Collection(n.DeviceTypeCollection, deviceDocuments())
+}
+
+// ProjectCollection holds the projects, next to the devices they use.
+func (mg DBClient) ProjectCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix + n.DeviceDatabase).Collection(n.ProjectCollection)
+}
+
+func (mg DBClient) UserCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix + n.UserDatabase).Collection(n.UserCollection)
+}
+
+func (mg DBClient) SessionCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix + n.UserDatabase).Collection(n.SessionCollection)
+}
+
+// MigrationCollection records applied migrations. It lives next to the
+// devices.
+func (mg DBClient) MigrationCollection() *mongo.Collection {
+	n := mg.names()
+	return mg.Client.Database(n.Prefix + n.DeviceDatabase).Collection(n.MigrationCollection)
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryInitial   = 500 * time.Millisecond
+	defaultRetryMax       = 30 * time.Second
+	defaultHealthInterval = 10 * time.Second
+)
+
+// Backoff computes exponentially growing waits between connection attempts.
+type Backoff struct {
+	// Initial is the wait after the first failed attempt.
+	Initial time.Duration
+	// Max caps the wait between two attempts.
+	Max time.Duration
+}
+
+// Next returns the wait before retrying after attempt failures in a row. Up
+// to a fifth of the wait is randomized so replicas that started together do
+// not hammer the database in lockstep.
+func (b Backoff) Next(attempt int) time.Duration {
+	initial, max := b.Initial, b.Max
+	if initial <= 0 {
+		initial = defaultRetryInitial
+	}
+	if max <= 0 {
+		max = defaultRetryMax
+	}
+
+	wait := initial
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait - time.Duration(rand.Int63n(int64(wait)/5+1))
+}
+
+// connState tracks whether the database answered its last health check.
+type connState struct {
+	ready     atomic.Bool
+	readyCh   chan struct{}
+	readyOnce sync.Once
+	done      chan struct{}
+	doneOnce  sync.Once
+}
+
+func newConnState() *connState {
+	return &connState{readyCh: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (s *connState) setReady(ready bool) (changed bool) {
+	if ready {
+		s.readyOnce.Do(func() { close(s.readyCh) })
+	}
+	return s.ready.Swap(ready) != ready
+}
+
+// monitor pings the database until it answers, then keeps checking it every
+// interval. While it is unreachable the pings back off exponentially. The
+// driver reconnects by itself, so monitor only has to notice when it does.
+func (mg DBClient) monitor(db DatabaseConnection) {
+	interval := db.HealthInterval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+
+	attempt := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+		err := mg.Client.Ping(ctx, nil)
+		cancel()
+
+		var wait time.Duration
+		if err == nil {
+			if mg.state.setReady(true) {
+				log.Println("Connected to db host: ", db.Host, " Port: ", db.Port)
+			}
+			attempt = 0
+			wait = interval
+		} else {
+			if mg.state.setReady(false) || attempt == 0 {
+				log.Println(ErrPingDB, ": ", err)
+			}
+			wait = db.Retry.Next(attempt)
+			attempt++
+		}
+
+		select {
+		case <-mg.state.done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WaitReady blocks until the database answered a ping for the first time or
+// ctx is done.
+func (mg DBClient) WaitReady(ctx context.Context) error {
+	if mg.Client == nil {
+		return errors.New(ErrNoClient)
+	}
+	if mg.state == nil {
+		return nil
+	}
+	select {
+	case <-mg.state.readyCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the health checks and disconnects from the database.
+func (mg DBClient) Close(ctx context.Context) error {
+	if mg.state != nil {
+		mg.state.doneOnce.Do(func() { close(mg.state.done) })
+	}
+	if mg.Client == nil {
+		return nil
+	}
+	return mg.Client.Disconnect(ctx)
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+)
+
+// Weights of the text index. A word in the name counts ten times as much as
+// one in the device type.
+const (
+	nameWeight       = 10
+	deviceTypeWeight = 1
+)
+
+// searchTerms splits text into lower case words like the text indexes do,
+// so "S7-1500" becomes s7 and 1500. Operators of the index query languages
+// are dropped with the punctuation.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := words[:0]
+	seen := make(map[string]bool, len(words))
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// searchDevices ranks devices by how often the terms of text appear in their
+// name and device type, for backends without a text index.
+func searchDevices(devices []model.Device, text string, limit int64) []model.DeviceMatch {
+	terms := searchTerms(text)
+	var matches []model.DeviceMatch
+	for _, device := range devices {
+		score := termScore(device.Name, terms)*nameWeight + termScore(device.DeviceTypeID, terms)*deviceTypeWeight
+		if score > 0 {
+			matches = append(matches, model.DeviceMatch{Device: device, Score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Device.ID < matches[j].Device.ID
+	})
+	if limit > 0 && int64(len(matches)) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+func termScore(s string, terms []string) float64 {
+	var score float64
+	for _, w := range searchTerms(s) {
+		for _, t := range terms {
+			if w == t {
+				score++
+			}
+		}
+	}
+	return score
+}
+
+// suggestNames returns the distinct names of devices starting with prefix,
+// ignoring case, in order.
+func suggestNames(devices []model.Device, prefix string, limit int64) []string {
+	prefix = strings.ToLower(prefix)
+	seen := make(map[string]bool)
+	var names []string
+	for _, device := range devices {
+		if !seen[device.Name] && strings.HasPrefix(strings.ToLower(device.Name), prefix) {
+			seen[device.Name] = true
+			names = append(names, device.Name)
+		}
+	}
+
+	sort.Strings(names)
+	if limit > 0 && int64(len(names)) > limit {
+		names = names[:limit]
+	}
+	return names
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type sqlKind int
+
+const (
+	sqlText sqlKind = iota
+	sqlInteger
+	sqlBool
+)
+
+// sqlColumn is a column of the devices table and the kind of its values.
+type sqlColumn struct {
+	name string
+	kind sqlKind
+}
+
+// sqlColumns maps the document keys of a device to their column. Attributes
+// are stored as JSON and are always matched in Go.
+var sqlColumns = map[string]sqlColumn{
+	"_id":                             {"id", sqlText},
+	"name":                            {"name", sqlText},
+	"devicetypeid":                    {"device_type_id", sqlText},
+	"failsafe":                        {"failsafe", sqlBool},
+	"tempmin":                         {"temp_min", sqlInteger},
+	"tempmax":                         {"temp_max", sqlInteger},
+	"installationposition":            {"installation_position", sqlText},
+	"insertinto19inchcabinet":         {"insert_into_19_inch_cabinet", sqlBool},
+	"motionenable":                    {"motion_enable", sqlBool},
+	"sipluscatalog":                   {"siplus_catalog", sqlBool},
+	"simaticcatalog":                  {"simatic_catalog", sqlBool},
+	"rotationaxisnumber":              {"rotation_axis_number", sqlInteger},
+	"positionaxisnumber":              {"position_axis_number", sqlInteger},
+	"advancedenvironmentalconditions": {"advanced_environmental_conditions", sqlBool},
+	"terminalelement":                 {"terminal_element", sqlBool},
+}
+
+var sqlOperators = map[string]string{
+	"$eq":  "=",
+	"$ne":  "!=",
+	"$gt":  ">",
+	"$gte": ">=",
+	"$lt":  "<",
+	"$lte": "<=",
+}
+
+// arg converts v to an argument compared with the column. It fails for
+// values of another kind, MongoDB never matches those and neither does the
+// Go evaluator, but SQLite would compare them.
+func (c sqlColumn) arg(v interface{}) (any, bool) {
+	switch v := normalize(v).(type) {
+	case string:
+		return v, c.kind == sqlText
+	case float64:
+		return v, c.kind == sqlInteger
+	case bool:
+		return v, c.kind == sqlBool
+	}
+	return nil, false
+}
+
+// sqlWhere splits filter into a condition SQLite can evaluate and the rest,
+// which has to be matched in Go. A device matches filter when it matches
+// both. An empty condition matches every row.
+func sqlWhere(filter bson.D) (string, []any, bson.D) {
+	var conds []string
+	var args []any
+	var rest bson.D
+	for _, e := range filter {
+		switch e.Key {
+		case "":
+			continue
+		case "$and":
+			// The clauses of $and are a conjunction like filter itself.
+			clauses, err := toDocList(e.Value)
+			if err != nil {
+				rest = append(rest, e)
+				continue
+			}
+			for _, clause := range clauses {
+				cond, a, r := sqlWhere(clause)
+				if cond != "" {
+					conds, args = append(conds, cond), append(args, a...)
+				}
+				rest = append(rest, r...)
+			}
+			continue
+		}
+		if cond, a, ok := sqlCondition(e); ok {
+			conds, args = append(conds, cond), append(args, a...)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	return strings.Join(conds, " AND "), args, rest
+}
+
+// sqlCondition translates a single filter element. It fails for operators
+// and keys without a column.
+func sqlCondition(e bson.E) (string, []any, bool) {
+	if e.Key == "$or" {
+		clauses, err := toDocList(e.Value)
+		if err != nil {
+			return "", nil, false
+		}
+		var conds []string
+		var args []any
+		for _, clause := range clauses {
+			cond, a, rest := sqlWhere(clause)
+			if len(rest) > 0 {
+				return "", nil, false
+			}
+			if cond == "" {
+				cond = "1"
+			}
+			conds, args = append(conds, "("+cond+")"), append(args, a...)
+		}
+		if len(conds) == 0 {
+			return "0", nil, true
+		}
+		return "(" + strings.Join(conds, " OR ") + ")", args, true
+	}
+
+	col, ok := sqlColumns[e.Key]
+	if !ok {
+		return "", nil, false
+	}
+	cond, isDoc := toDoc(e.Value)
+	if !isDoc || !isOperatorDoc(cond) {
+		arg, ok := col.arg(e.Value)
+		return col.name + " = ?", []any{arg}, ok
+	}
+
+	var conds []string
+	var args []any
+	for _, c := range cond {
+		if c.Key == "$in" {
+			list, err := toList(c.Value)
+			if err != nil {
+				return "", nil, false
+			}
+			if len(list) == 0 {
+				conds = append(conds, "0")
+				continue
+			}
+			for _, v := range list {
+				arg, ok := col.arg(v)
+				if !ok {
+					return "", nil, false
+				}
+				args = append(args, arg)
+			}
+			conds = append(conds, col.name+" IN (?"+strings.Repeat(", ?", len(list)-1)+")")
+			continue
+		}
+		op, ok := sqlOperators[c.Key]
+		if !ok {
+			return "", nil, false
+		}
+		arg, ok := col.arg(c.Value)
+		if !ok {
+			return "", nil, false
+		}
+		conds, args = append(conds, col.name+" "+op+" ?"), append(args, arg)
+	}
+	return strings.Join(conds, " AND "), args, true
+}
+
+// sqlOrder translates a sort document to an ORDER BY list. Ties are ordered
+// by id like the sort of FindOptions.apply, which keeps the id order of its
+// input. It fails for keys without a column.
+func sqlOrder(sortDoc bson.D) (string, bool) {
+	keys := make([]string, 0, len(sortDoc)+1)
+	for _, e := range sortDoc {
+		col, ok := sqlColumns[e.Key]
+		if !ok {
+			return "", false
+		}
+		if direction, ok := normalize(e.Value).(float64); ok && direction < 0 {
+			keys = append(keys, col.name+" DESC")
+		} else {
+			keys = append(keys, col.name)
+		}
+	}
+	return strings.Join(append(keys, "id"), ", "), true
+}
@@ -0,0 +1,826 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/helper"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order and recorded in schema_migrations.
+// Never edit a released entry, append a new one instead.
+var sqliteMigrations = []string{
+	`CREATE TABLE devices (
+		id                                TEXT PRIMARY KEY,
+		name                              TEXT NOT NULL DEFAULT '',
+		device_type_id                    TEXT NOT NULL DEFAULT '',
+		failsafe                          INTEGER NOT NULL DEFAULT 0,
+		temp_min                          INTEGER NOT NULL DEFAULT 0,
+		temp_max                          INTEGER NOT NULL DEFAULT 0,
+		installation_position             TEXT NOT NULL DEFAULT '',
+		insert_into_19_inch_cabinet       INTEGER NOT NULL DEFAULT 0,
+		motion_enable                     INTEGER NOT NULL DEFAULT 0,
+		siplus_catalog                    INTEGER NOT NULL DEFAULT 0,
+		simatic_catalog                   INTEGER NOT NULL DEFAULT 0,
+		rotation_axis_number              INTEGER NOT NULL DEFAULT 0,
+		position_axis_number              INTEGER NOT NULL DEFAULT 0,
+		advanced_environmental_conditions INTEGER NOT NULL DEFAULT 0,
+		terminal_element                  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE users (
+		username TEXT PRIMARY KEY,
+		password TEXT NOT NULL
+	);
+	CREATE TABLE sessions (
+		token    TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		expiry   TEXT NOT NULL
+	);`,
+	`CREATE INDEX sessions_expiry ON sessions (expiry);`,
+	`CREATE VIRTUAL TABLE devices_fts USING fts5(name, device_type_id, content='devices', content_rowid='rowid');
+	CREATE TRIGGER devices_fts_insert AFTER INSERT ON devices BEGIN
+		INSERT INTO devices_fts (rowid, name, device_type_id) VALUES (new.rowid, new.name, new.device_type_id);
+	END;
+	CREATE TRIGGER devices_fts_delete AFTER DELETE ON devices BEGIN
+		INSERT INTO devices_fts (devices_fts, rowid, name, device_type_id) VALUES ('delete', old.rowid, old.name, old.device_type_id);
+	END;
+	CREATE TRIGGER devices_fts_update AFTER UPDATE ON devices BEGIN
+		INSERT INTO devices_fts (devices_fts, rowid, name, device_type_id) VALUES ('delete', old.rowid, old.name, old.device_type_id);
+		INSERT INTO devices_fts (rowid, name, device_type_id) VALUES (new.rowid, new.name, new.device_type_id);
+	END;
+	INSERT INTO devices_fts (devices_fts) VALUES ('rebuild');
+	CREATE INDEX devices_name ON devices (name COLLATE NOCASE);`,
+	`CREATE TABLE device_types (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		defaults    TEXT NOT NULL DEFAULT 'null'
+	);
+	INSERT INTO device_types (id, name)
+		SELECT DISTINCT device_type_id, device_type_id FROM devices WHERE device_type_id != '';
+	CREATE INDEX devices_device_type_id ON devices (device_type_id);`,
+	`ALTER TABLE devices ADD COLUMN attributes TEXT NOT NULL DEFAULT 'null';
+	ALTER TABLE device_types ADD COLUMN attributes_schema TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE projects (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		cabinets    TEXT NOT NULL DEFAULT 'null'
+	);`,
+	`ALTER TABLE projects ADD COLUMN version INTEGER NOT NULL DEFAULT 0;`,
+}
+
+const deviceColumns = `id, name, device_type_id, failsafe, temp_min, temp_max,
+	installation_position, insert_into_19_inch_cabinet, motion_enable,
+	siplus_catalog, simatic_catalog, rotation_axis_number, position_axis_number,
+	advanced_environmental_conditions, terminal_element, attributes`
+
+// SQLiteStore is a Store backed by an embedded SQLite database. It is meant
+// for single-node deployments with a small catalog: equality, comparisons and
+// $in on device fields run in SQL, other filters are evaluated in Go with the
+// same semantics as MongoDB.
+type SQLiteStore struct {
+	DB *sql.DB
+	// OperationTimeout bounds every single database operation on top of the
+	// caller's context. Zero means no additional limit.
+	OperationTimeout time.Duration
+}
+
+// OpenSQLite opens or creates the database file at path and brings its schema
+// up to date.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, errors.New("sqlite database path is empty")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, serialize access instead of failing with
+	// SQLITE_BUSY under load.
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{DB: db}
+	if err := store.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Println("Opened sqlite database: ", path)
+	return store, nil
+}
+
+// Migrate applies every schema migration that has not been recorded yet.
+func (s *SQLiteStore) Migrate() error {
+	_, err := s.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", version, err)
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Println("Applied sqlite migration: ", version)
+	}
+	return nil
+}
+
+// withTimeout derives the context for a single operation.
+func (s *SQLiteStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.OperationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.OperationTimeout)
+}
+
+func (s *SQLiteStore) ClientStatusDB() error {
+	if s == nil || s.DB == nil {
+		return errors.New(ErrNoClient)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDevice reads the deviceColumns of row, extra receives the columns
+// selected after them.
+func scanDevice(row rowScanner, extra ...any) (model.Device, error) {
+	var d model.Device
+	dest := append([]any{&d.ID, &d.Name, &d.DeviceTypeID, &d.Failsafe, &d.TempMin, &d.TempMax,
+		&d.InstallationPosition, &d.InsertInto19InchCabinet, &d.MotionEnable,
+		&d.SiplusCatalog, &d.SimaticCatalog, &d.RotationAxisNumber, &d.PositionAxisNumber,
+		&d.AdvancedEnvironmentalConditions, &d.TerminalElement, jsonColumn{&d.Attributes}}, extra...)
+	err := row.Scan(dest...)
+	return d, err
+}
+
+// queryDevices returns the stored devices matching filter, ordered, limited
+// and projected by opts. The parts of filter that sqlWhere translates are
+// evaluated by SQLite, only the rest is matched in Go. Order and limit go
+// into the query too unless devices are left to be matched in Go.
+func (s *SQLiteStore) queryDevices(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, filter bson.D, opts FindOptions) ([]model.Device, error) {
+	where, args, rest := sqlWhere(filter)
+	query := `SELECT ` + deviceColumns + ` FROM devices`
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+	if order, ok := sqlOrder(opts.Sort); ok && len(rest) == 0 {
+		query += ` ORDER BY ` + order
+		if opts.Limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, opts.Limit)
+		}
+		opts.Sort, opts.Limit = nil, 0
+	} else {
+		query += ` ORDER BY id`
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []model.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		if devices, err = filterDevices(devices, rest); err != nil {
+			return nil, err
+		}
+	}
+	return opts.apply(devices)
+}
+
+func (s *SQLiteStore) GetDeviceDB(ctx context.Context, filter bson.D, opts FindOptions) (model.Devices, error) {
+	var devices model.Devices
+	err := s.ClientStatusDB()
+	if err != nil {
+		return devices, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	devices.Devices, err = s.queryDevices(ctx, s.DB, filter, opts)
+	return devices, err
+}
+
+// SearchDevicesDB ranks the matches of the devices_fts index with bm25. The
+// terms are quoted, so the FTS5 query syntax is not exposed.
+func (s *SQLiteStore) SearchDevicesDB(ctx context.Context, text string, limit int64) ([]model.DeviceMatch, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	for i, t := range terms {
+		terms[i] = `"` + t + `"`
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`SELECT %s, score FROM devices JOIN (
+			SELECT rowid, -bm25(devices_fts, %d, %d) AS score FROM devices_fts WHERE devices_fts MATCH ?
+		) AS m ON devices.rowid = m.rowid
+		ORDER BY score DESC, id LIMIT ?`, deviceColumns, nameWeight, deviceTypeWeight),
+		strings.Join(terms, " OR "), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []model.DeviceMatch
+	for rows.Next() {
+		var m model.DeviceMatch
+		m.Device, err = scanDevice(rows, &m.Score)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// SuggestDeviceNamesDB uses the devices_name index, LIKE ignores case.
+func (s *SQLiteStore) SuggestDeviceNamesDB(ctx context.Context, prefix string, limit int64) ([]string, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := s.DB.QueryContext(ctx, `SELECT DISTINCT name FROM devices
+		WHERE name LIKE ? ESCAPE '\' ORDER BY name LIMIT ?`, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteDeviceDB(ctx context.Context, filter bson.D, deleteMany bool) (int64, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if !deleteMany && filter == nil {
+		return 0, errors.New("device id must be specified")
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	devices, err := s.queryDevices(ctx, tx, filter, FindOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, device := range devices {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM devices WHERE id = ?`, device.ID); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(devices)), tx.Commit()
+}
+
+// WriteDevicesDB stores the batch in one transaction. Unless opts.Atomic is
+// set every device gets its own savepoint, so a failing device is rolled
+// back on its own and the others are kept.
+func (s *SQLiteStore) WriteDevicesDB(ctx context.Context, devices model.Devices, opts WriteOptions) ([]model.DeviceWriteResult, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing := make(map[string]model.Device)
+	if ids := deviceIDs(devices.Devices); len(ids) > 0 {
+		found, err := s.queryDevices(ctx, tx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, FindOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range found {
+			existing[device.ID] = device
+		}
+	}
+
+	results, writes := planDeviceWrites(devices.Devices, existing, opts)
+	if opts.Atomic && rejected(results) {
+		failWrites(results, writes, nil, true)
+		return results, nil
+	}
+
+	failed := make(map[int]string)
+	for _, w := range writes {
+		if !opts.Atomic {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT device`); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := upsertDevice(ctx, tx, w.stored); err != nil {
+			failed[w.result] = err.Error()
+			if opts.Atomic {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO device`); err != nil {
+				return nil, err
+			}
+		}
+
+		if !opts.Atomic {
+			if _, err := tx.ExecContext(ctx, `RELEASE device`); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	failWrites(results, writes, failed, opts.Atomic)
+	if opts.Atomic && rejected(results) {
+		return results, tx.Rollback()
+	}
+	return results, tx.Commit()
+}
+
+func upsertDevice(ctx context.Context, tx *sql.Tx, d model.Device) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO devices (`+deviceColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			device_type_id = excluded.device_type_id,
+			failsafe = excluded.failsafe,
+			temp_min = excluded.temp_min,
+			temp_max = excluded.temp_max,
+			installation_position = excluded.installation_position,
+			insert_into_19_inch_cabinet = excluded.insert_into_19_inch_cabinet,
+			motion_enable = excluded.motion_enable,
+			siplus_catalog = excluded.siplus_catalog,
+			simatic_catalog = excluded.simatic_catalog,
+			rotation_axis_number = excluded.rotation_axis_number,
+			position_axis_number = excluded.position_axis_number,
+			advanced_environmental_conditions = excluded.advanced_environmental_conditions,
+			terminal_element = excluded.terminal_element,
+			attributes = excluded.attributes`,
+		d.ID, d.Name, d.DeviceTypeID, d.Failsafe, d.TempMin, d.TempMax,
+		d.InstallationPosition, d.InsertInto19InchCabinet, d.MotionEnable,
+		d.SiplusCatalog, d.SimaticCatalog, d.RotationAxisNumber, d.PositionAxisNumber,
+		d.AdvancedEnvironmentalConditions, d.TerminalElement, jsonColumn{d.Attributes})
+	return err
+}
+
+// jsonColumn stores v as JSON text. To scan into it v must be a pointer.
+type jsonColumn struct {
+	v any
+}
+
+func (c jsonColumn) Value() (driver.Value, error) {
+	b, err := json.Marshal(c.v)
+	return string(b), err
+}
+
+func (c jsonColumn) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), c.v)
+	case []byte:
+		return json.Unmarshal(src, c.v)
+	}
+	return fmt.Errorf("cannot scan %T into a JSON column", src)
+}
+
+func (s *SQLiteStore) GetDeviceTypesDB(ctx context.Context, ids []string) ([]model.DeviceType, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+	if ids != nil && len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, defaults, attributes_schema FROM device_types`
+	args := make([]any, len(ids))
+	if ids != nil {
+		for i, id := range ids {
+			args[i] = id
+		}
+		query += ` WHERE id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+	}
+	rows, err := s.DB.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []model.DeviceType
+	for rows.Next() {
+		var t model.DeviceType
+		var schema string
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, jsonColumn{&t.Defaults}, &schema); err != nil {
+			return nil, err
+		}
+		if schema != "" {
+			t.AttributesSchema = json.RawMessage(schema)
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+func (s *SQLiteStore) PutDeviceTypeDB(ctx context.Context, t model.DeviceType, create bool) (bool, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM device_types WHERE id = ?)`, t.ID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists && create {
+		return false, errors.New(ErrDeviceTypeExists)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO device_types (id, name, description, defaults, attributes_schema)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			description = excluded.description,
+			defaults = excluded.defaults,
+			attributes_schema = excluded.attributes_schema`,
+		t.ID, t.Name, t.Description, jsonColumn{t.Defaults}, string(t.AttributesSchema))
+	if err != nil {
+		return false, err
+	}
+	return !exists, tx.Commit()
+}
+
+// DeleteDeviceTypeDB checks, moves or deletes the devices and deletes the
+// type in one transaction.
+func (s *SQLiteStore) DeleteDeviceTypeDB(ctx context.Context, id string, opts DeleteTypeOptions) (int64, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM device_types WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrNotFound
+	}
+
+	switch {
+	case opts.Cascade:
+		res, err = tx.ExecContext(ctx, `DELETE FROM devices WHERE device_type_id = ?`, id)
+	case opts.Reassign != "":
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM device_types WHERE id = ?)`, opts.Reassign).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("%s %q", ErrUnknownDeviceType, opts.Reassign)
+		}
+		res, err = tx.ExecContext(ctx, `UPDATE devices SET device_type_id = ? WHERE device_type_id = ?`, opts.Reassign, id)
+	default:
+		var inUse bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM devices WHERE device_type_id = ?)`, id).Scan(&inUse)
+		if err != nil {
+			return 0, err
+		}
+		if inUse {
+			return 0, errors.New(ErrDeviceTypeInUse)
+		}
+		return 0, tx.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return affected, tx.Commit()
+}
+
+func (s *SQLiteStore) GetProjectsDB(ctx context.Context, ids []string) ([]model.Project, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return nil, err
+	}
+	if ids != nil && len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, cabinets, version FROM projects`
+	args := make([]any, len(ids))
+	if ids != nil {
+		for i, id := range ids {
+			args[i] = id
+		}
+		query += ` WHERE id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+	}
+	rows, err := s.DB.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []model.Project
+	for rows.Next() {
+		var p model.Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, jsonColumn{&p.Cabinets}, &p.Version); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+func (s *SQLiteStore) PutProjectDB(ctx context.Context, p model.Project, create bool) (bool, error) {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM projects WHERE id = ?)`, p.ID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists && create {
+		return false, errors.New(ErrProjectExists)
+	}
+
+	if !exists {
+		_, err = tx.ExecContext(ctx, `INSERT INTO projects (id, name, description, cabinets, version)
+			VALUES (?, ?, ?, ?, ?)`,
+			p.ID, p.Name, p.Description, jsonColumn{p.Cabinets}, p.Version+1)
+		if err != nil {
+			return false, err
+		}
+		return true, tx.Commit()
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE projects
+		SET name = ?, description = ?, cabinets = ?, version = version + 1
+		WHERE id = ? AND version = ?`,
+		p.Name, p.Description, jsonColumn{p.Cabinets}, p.ID, p.Version)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, errors.New(ErrProjectVersion)
+	}
+	return false, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteProjectDB(ctx context.Context, id string) error {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM projects WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) CreateUserDB(ctx context.Context, user model.UserCredentials) error {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if user.Username == "" {
+		return errors.New(ErrUsernameEmpty)
+	}
+
+	hashedPassword, err := helper.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.DB.ExecContext(ctx, `INSERT INTO users (username, password) VALUES (?, ?)
+		ON CONFLICT (username) DO NOTHING`, user.Username, hashedPassword)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(ErrUserExists)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetUserDB(ctx context.Context, username string) (model.UserCredentials, error) {
+	var user model.UserCredentials
+	err := s.ClientStatusDB()
+	if err != nil {
+		return user, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.DB.QueryRowContext(ctx, `SELECT username, password FROM users WHERE username = ?`, username).
+		Scan(&user.Username, &user.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (s *SQLiteStore) CreateSessionDB(ctx context.Context, us session.UserSession) error {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err = s.DB.ExecContext(ctx, `INSERT INTO sessions (token, username, expiry) VALUES (?, ?, ?)
+		ON CONFLICT (token) DO UPDATE SET username = excluded.username, expiry = excluded.expiry`,
+		us.Token, us.Username, us.Expiry.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (s *SQLiteStore) GetTokenDB(ctx context.Context, token string) (session.UserSession, error) {
+	var us session.UserSession
+	err := s.ClientStatusDB()
+	if err != nil {
+		return us, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var expiry string
+	err = s.DB.QueryRowContext(ctx, `SELECT token, username, expiry FROM sessions WHERE token = ?`, token).
+		Scan(&us.Token, &us.Username, &expiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return us, ErrNotFound
+	}
+	if err != nil {
+		return us, err
+	}
+
+	us.Expiry, err = time.Parse(time.RFC3339Nano, expiry)
+	return us, err
+}
+
+func (s *SQLiteStore) DeleteTokenDB(ctx context.Context, token string) error {
+	err := s.ClientStatusDB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE token = ?`, token)
+	return err
+}
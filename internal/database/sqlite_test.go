@@ -0,0 +1,150 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func openTestSQLite(t *testing.T) *database.SQLiteStore {
+	t.Helper()
+	store, err := database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.DB.Close() })
+	return store
+}
+
+func TestSQLiteMigrateIsIdempotent(t *testing.T) {
+	store := openTestSQLite(t)
+	assert.Nil(t, store.Migrate())
+
+	var version int
+	assert.Nil(t, store.DB.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Greater(t, version, 0)
+}
+
+func TestSQLiteStoreDevices(t *testing.T) {
+	store := openTestSQLite(t)
+	writeDevices(t, store, testDevices, database.WriteOptions{})
+	writeDevices(t, store, rename, database.WriteOptions{Fields: renameFields})
+
+	got, err := store.GetDeviceDB(ctx, bson.D{{Key: "_id", Value: "b"}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, got.Devices, 1)
+	assert.Equal(t, "renamed", got.Devices[0].Name)
+	assert.Equal(t, 60, got.Devices[0].TempMax)
+
+	failsafe, err := store.GetDeviceDB(ctx, bson.D{{Key: "failsafe", Value: true}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, failsafe.Devices, 2)
+
+	deleted, err := store.DeleteDeviceDB(ctx, bson.D{{Key: "failsafe", Value: true}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+	all, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, all.Devices, 1)
+}
+
+// rejectDevice makes the store fail every write of a device with name.
+func rejectDevice(t *testing.T, store *database.SQLiteStore, name string) {
+	t.Helper()
+	_, err := store.DB.Exec(`CREATE TRIGGER reject BEFORE INSERT ON devices
+		WHEN NEW.name = '` + name + `' BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStoreWriteKeepsOthersOnFailure(t *testing.T) {
+	store := openTestSQLite(t)
+	rejectDevice(t, store, "ET 200SP")
+
+	results := writeDevices(t, store, testDevices, database.WriteOptions{})
+	assert.Equal(t, model.WriteCreated, results[0].Status)
+	assert.Equal(t, model.WriteFailed, results[1].Status)
+	assert.Contains(t, results[1].Reason, "rejected")
+	assert.Equal(t, model.WriteCreated, results[2].Status)
+
+	all, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, all.Devices, 2)
+}
+
+func TestSQLiteStoreAtomicWriteRollsBack(t *testing.T) {
+	store := openTestSQLite(t)
+	rejectDevice(t, store, "ET 200SP")
+
+	results := writeDevices(t, store, testDevices, database.WriteOptions{Atomic: true})
+	assert.Equal(t, model.WriteFailed, results[0].Status)
+	assert.Equal(t, database.ReasonRolledBack, results[0].Reason)
+	assert.Contains(t, results[1].Reason, "rejected")
+
+	all, err := store.GetDeviceDB(ctx, bson.D{{}}, database.FindOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, all.Devices)
+}
+
+func TestSQLiteStoreUsersAndSessions(t *testing.T) {
+	store := openTestSQLite(t)
+	creds := model.UserCredentials{Username: "TestUser", Password: "secret"}
+	assert.Nil(t, store.CreateUserDB(ctx, creds))
+	assert.EqualError(t, store.CreateUserDB(ctx, creds), database.ErrUserExists)
+
+	_, err := store.GetUserDB(ctx, "unknown")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+
+	expiry := time.Now().Add(time.Minute)
+	assert.Nil(t, store.CreateSessionDB(ctx, session.UserSession{Username: "TestUser", Token: "token", Expiry: expiry}))
+	got, err := store.GetTokenDB(ctx, "token")
+	assert.Nil(t, err)
+	assert.True(t, expiry.Equal(got.Expiry))
+
+	assert.Nil(t, store.DeleteTokenDB(ctx, "token"))
+	_, err = store.GetTokenDB(ctx, "token")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestSQLiteStoreSearch(t *testing.T) {
+	store := openTestSQLite(t)
+	testSearch(t, store)
+
+	// The triggers keep the text index in sync with the devices.
+	writeDevices(t, store, model.Devices{Devices: []model.Device{{ID: "c", Name: "ET 200MP CPU"}}}, database.WriteOptions{Fields: renameFields})
+	_, err := store.DeleteDeviceDB(ctx, bson.D{{Key: "_id", Value: "a"}}, false)
+	assert.Nil(t, err)
+
+	matches, err := store.SearchDevicesDB(ctx, "cpu", 0)
+	assert.Nil(t, err)
+	if assert.Len(t, matches, 3) {
+		assert.Equal(t, "c", matches[0].Device.ID)
+	}
+}
+
+func TestSQLiteStoreGetDeviceFilter(t *testing.T) {
+	testGetDeviceFilter(t, openTestSQLite(t))
+}
+
+func TestSQLiteStoreGetDeviceSortAndLimit(t *testing.T) {
+	testGetDeviceSortAndLimit(t, openTestSQLite(t))
+}
+
+func TestSQLiteStoreDeviceTypes(t *testing.T) {
+	testDeviceTypes(t, openTestSQLite(t))
+}
+
+func TestSQLiteStoreAttributes(t *testing.T) {
+	testAttributes(t, openTestSQLite(t))
+}
+
+func TestSQLiteStoreProjects(t *testing.T) {
+	testProjects(t, openTestSQLite(t))
+}
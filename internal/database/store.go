@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/session"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned by every backend when a lookup matches nothing. It
+// is the driver's sentinel so callers only have to check for one value.
+var ErrNotFound = mongo.ErrNoDocuments
+
+// DeviceStore persists the device catalog.
+type DeviceStore interface {
+	GetDeviceDB(ctx context.Context, filter bson.D, opts FindOptions) (model.Devices, error)
+	WriteDevicesDB(ctx context.Context, devices model.Devices, opts WriteOptions) ([]model.DeviceWriteResult, error)
+	// SearchDevicesDB returns up to limit devices with a word of text in their
+	// name or device type, best matches first.
+	SearchDevicesDB(ctx context.Context, text string, limit int64) ([]model.DeviceMatch, error)
+	// SuggestDeviceNamesDB returns up to limit distinct device names that
+	// start with prefix, ignoring case, in order.
+	SuggestDeviceNamesDB(ctx context.Context, prefix string, limit int64) ([]string, error)
+	// DeleteDeviceDB returns the number of deleted devices.
+	DeleteDeviceDB(ctx context.Context, filter bson.D, deleteMany bool) (int64, error)
+}
+
+// DeleteTypeOptions say what happens to the devices of a deleted device type.
+// Without options a type that still has devices cannot be deleted.
+type DeleteTypeOptions struct {
+	// Cascade deletes the devices along with their type.
+	Cascade bool
+	// Reassign moves the devices to this type, which has to exist.
+	Reassign string
+}
+
+// DeviceTypeStore persists the device types that devices refer to.
+type DeviceTypeStore interface {
+	// GetDeviceTypesDB returns the types with the given ids ordered by id,
+	// nil ids returns every type.
+	GetDeviceTypesDB(ctx context.Context, ids []string) ([]model.DeviceType, error)
+	// PutDeviceTypeDB creates or replaces a type and reports whether it was
+	// created. With create set an existing type fails with ErrDeviceTypeExists.
+	PutDeviceTypeDB(ctx context.Context, t model.DeviceType, create bool) (bool, error)
+	// DeleteDeviceTypeDB deletes a type and returns the number of devices that
+	// opts deleted or reassigned. An unknown type fails with ErrNotFound, one
+	// that still has devices without options with ErrDeviceTypeInUse.
+	DeleteDeviceTypeDB(ctx context.Context, id string, opts DeleteTypeOptions) (int64, error)
+}
+
+// ProjectStore persists projects with their cabinets and racks. A project is
+// stored as one document.
+type ProjectStore interface {
+	// GetProjectsDB returns the projects with the given ids ordered by id,
+	// nil ids returns every project.
+	GetProjectsDB(ctx context.Context, ids []string) ([]model.Project, error)
+	// PutProjectDB creates or replaces a project and reports whether it was
+	// created. The project is stored with version p.Version+1. Replacing a
+	// project whose stored version is not p.Version fails with
+	// ErrProjectVersion. With create set an existing project fails with
+	// ErrProjectExists.
+	PutProjectDB(ctx context.Context, p model.Project, create bool) (bool, error)
+	// DeleteProjectDB deletes a project, an unknown one fails with
+	// ErrNotFound.
+	DeleteProjectDB(ctx context.Context, id string) error
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	CreateUserDB(ctx context.Context, user model.UserCredentials) error
+	GetUserDB(ctx context.Context, username string) (model.UserCredentials, error)
+}
+
+// SessionStore persists login sessions.
+type SessionStore interface {
+	CreateSessionDB(ctx context.Context, s session.UserSession) error
+	GetTokenDB(ctx context.Context, token string) (session.UserSession, error)
+	DeleteTokenDB(ctx context.Context, token string) error
+}
+
+// Store is everything the HTTP handlers need from a storage backend. All
+// methods taking a context give up once it is done and return its error.
+type Store interface {
+	DeviceStore
+	DeviceTypeStore
+	ProjectStore
+	UserStore
+	SessionStore
+	ClientStatusDB() error
+}
+
+const (
+	BackendMongo  = "mongo"
+	BackendSQLite = "sqlite"
+	BackendMemory = "memory"
+)
+
+var (
+	_ Store = DBClient{}
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
+
+// Open connects to the storage backend selected by db.Backend. MongoDB is
+// used when no backend is configured.
+func (db DatabaseConnection) Open() (Store, error) {
+	switch db.Backend {
+	case "", BackendMongo:
+		client, err := db.ConnectDB()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendSQLite:
+		store, err := OpenSQLite(db.Path)
+		if err != nil {
+			return nil, err
+		}
+		store.OperationTimeout = db.OperationTimeout
+		return store, nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown database backend %q", db.Backend)
+}
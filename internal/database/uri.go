@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+var readPreferences = map[string]bool{
+	"primary":            true,
+	"primaryPreferred":   true,
+	"secondary":          true,
+	"secondaryPreferred": true,
+	"nearest":            true,
+}
+
+// hasOptions reports whether any of the structured connection options is set.
+func (db DatabaseConnection) hasOptions() bool {
+	return len(db.Hosts) > 0 || db.SRV || db.ReplicaSet != "" || db.AuthSource != "" ||
+		db.TLS || db.TLSCAFile != "" || db.TLSInsecure || db.MaxPoolSize > 0 || db.ReadPreference != ""
+}
+
+// GetConnStr returns the MongoDB connection string. A configured URI is used
+// as is, otherwise it is built from the structured fields with credentials
+// and options escaped.
+func (db DatabaseConnection) GetConnStr() string {
+	if db.URI != "" {
+		u, err := url.Parse(db.URI)
+		if err != nil || u.User != nil || db.User == "" {
+			return db.URI
+		}
+		u.User = url.UserPassword(db.User, db.Password)
+		return u.String()
+	}
+
+	u := url.URL{Scheme: connstring.SchemeMongoDB}
+	if db.SRV {
+		u.Scheme = connstring.SchemeMongoDBSRV
+	}
+	if db.User != "" && db.Password != "" {
+		u.User = url.UserPassword(db.User, db.Password)
+	}
+
+	if len(db.Hosts) > 0 {
+		u.Host = strings.Join(db.Hosts, ",")
+	} else if db.SRV || db.Port == "" {
+		u.Host = db.Host
+	} else {
+		u.Host = net.JoinHostPort(db.Host, db.Port)
+	}
+
+	q := url.Values{}
+	if db.ReplicaSet != "" {
+		q.Set("replicaSet", db.ReplicaSet)
+	}
+	if db.AuthSource != "" {
+		q.Set("authSource", db.AuthSource)
+	}
+	if db.TLS {
+		q.Set("tls", "true")
+	}
+	if db.TLSCAFile != "" {
+		q.Set("tlsCAFile", db.TLSCAFile)
+	}
+	if db.TLSInsecure {
+		q.Set("tlsInsecure", "true")
+	}
+	if db.MaxPoolSize > 0 {
+		q.Set("maxPoolSize", strconv.FormatUint(db.MaxPoolSize, 10))
+	}
+	if db.ReadPreference != "" {
+		q.Set("readPreference", db.ReadPreference)
+	}
+	if len(q) > 0 {
+		u.Path = "/"
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// Validate checks the connection settings before connecting so that a broken
+// configuration fails at startup instead of on the first request.
+func (db DatabaseConnection) Validate() error {
+	if db.URI != "" && db.hasOptions() {
+		return errors.New("database URI cannot be combined with hosts or connection options")
+	}
+
+	if db.URI == "" {
+		if db.Host == "" && len(db.Hosts) == 0 {
+			return errors.New("database host is empty")
+		}
+		if db.SRV {
+			hosts := db.Hosts
+			if len(hosts) == 0 {
+				hosts = []string{db.Host}
+			}
+			if len(hosts) > 1 {
+				return errors.New("mongodb+srv takes exactly one host")
+			}
+			if strings.Contains(hosts[0], ":") {
+				return errors.New("mongodb+srv host must not have a port")
+			}
+		}
+		if (db.User == "") != (db.Password == "") {
+			return errors.New("database user and password must be set together")
+		}
+		if db.ReadPreference != "" && !readPreferences[db.ReadPreference] {
+			return fmt.Errorf("unknown read preference %q", db.ReadPreference)
+		}
+		if (db.TLSCAFile != "" || db.TLSInsecure) && !db.TLS {
+			return errors.New("tls options need tls to be enabled")
+		}
+		if db.TLSCAFile != "" {
+			if _, err := os.Stat(db.TLSCAFile); err != nil {
+				return fmt.Errorf("tls ca file: %w", err)
+			}
+		}
+	}
+
+	uri := db.GetConnStr()
+	if strings.HasPrefix(uri, connstring.SchemeMongoDBSRV+"://") {
+		// Parsing a mongodb+srv URI resolves DNS, leave that to Connect.
+		_, err := url.Parse(uri)
+		return err
+	}
+	if _, err := connstring.ParseAndValidate(uri); err != nil {
+		return fmt.Errorf("invalid database connection: %w", err)
+	}
+	return nil
+}
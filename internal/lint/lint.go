@@ -0,0 +1,120 @@
+// Package lint checks devices against the catalog rules of the
+// configuration. A rule requires every device that matches its When
+// expression to also match its Require expression. Both are expressions like
+// the q parameter of GET /v1/devices, see query.ParseExpr.
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Config is a rule as written in the Rules section of the configuration.
+type Config struct {
+	// Name identifies the rule in findings.
+	Name string
+	// Severity is model.SeverityError or model.SeverityWarning.
+	Severity string
+	// When selects the devices the rule applies to, empty selects all.
+	When string
+	// Require has to hold for every selected device.
+	Require string
+	// Message explains a finding to the client.
+	Message string
+}
+
+// Rule is a checked and compiled Config.
+type Rule struct {
+	Name     string
+	Severity string
+	Message  string
+
+	// when is nil for rules that apply to every device.
+	when    bson.D
+	require bson.D
+}
+
+// Rules are the catalog rules of a server, checked in order.
+type Rules []Rule
+
+// Compile checks the configured rules and parses their expressions. Names
+// have to be unique.
+func Compile(configs []Config) (Rules, error) {
+	rules := make(Rules, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+	for i, c := range configs {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		case seen[c.Name]:
+			return nil, fmt.Errorf("rule %q is declared twice", c.Name)
+		case c.Severity != model.SeverityError && c.Severity != model.SeverityWarning:
+			return nil, fmt.Errorf("rule %q: severity must be %s or %s, got %q", c.Name, model.SeverityError, model.SeverityWarning, c.Severity)
+		case strings.TrimSpace(c.Require) == "":
+			return nil, fmt.Errorf("rule %q has no require expression", c.Name)
+		}
+		seen[c.Name] = true
+
+		r := Rule{Name: c.Name, Severity: c.Severity, Message: c.Message}
+		if r.Message == "" {
+			r.Message = fmt.Sprintf("device breaks rule %s", c.Name)
+		}
+		if strings.TrimSpace(c.When) != "" {
+			e, err := query.ParseExpr(c.When)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q when: %w", c.Name, err)
+			}
+			r.when = e.Filter()
+		}
+		e, err := query.ParseExpr(c.Require)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q require: %w", c.Name, err)
+		}
+		r.require = e.Filter()
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Check returns a finding for every rule device breaks.
+func (rs Rules) Check(device model.Device) ([]model.RuleFinding, error) {
+	var findings []model.RuleFinding
+	for _, r := range rs {
+		broken, err := r.breaks(device)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		if broken {
+			findings = append(findings, model.RuleFinding{Rule: r.Name, Severity: r.Severity, Message: r.Message})
+		}
+	}
+	return findings, nil
+}
+
+func (r Rule) breaks(device model.Device) (bool, error) {
+	if r.when != nil {
+		applies, err := database.MatchDevice(device, r.when)
+		if err != nil || !applies {
+			return false, err
+		}
+	}
+	ok, err := database.MatchDevice(device, r.require)
+	return !ok, err
+}
+
+// WithSeverity returns the findings of the given severity.
+func WithSeverity(findings []model.RuleFinding, severity string) []model.RuleFinding {
+	var selected []model.RuleFinding
+	for _, f := range findings {
+		if f.Severity == severity {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,57 @@
+package lint_test
+
+import (
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/lint"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRules = []lint.Config{
+	{
+		Name:     "siplus-extended-temperature",
+		Severity: model.SeverityError,
+		When:     "siplusCatalog",
+		Require:  "tempMin <= -25 and tempMax >= 70",
+		Message:  "SIPLUS devices need an extended temperature range",
+	},
+	{
+		Name:     "axes-need-motion",
+		Severity: model.SeverityWarning,
+		When:     "not motionEnable",
+		Require:  "rotationAxisNumber == 0 and positionAxisNumber == 0",
+	},
+}
+
+func TestCheck(t *testing.T) {
+	rules, err := lint.Compile(testRules)
+	assert.Nil(t, err)
+
+	findings, err := rules.Check(model.Device{SiplusCatalog: true, TempMin: -40, TempMax: 70, MotionEnable: true, RotationAxisNumber: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, findings)
+
+	findings, err = rules.Check(model.Device{SiplusCatalog: true, TempMin: 0, TempMax: 60, PositionAxisNumber: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []model.RuleFinding{
+		{Rule: "siplus-extended-temperature", Severity: model.SeverityError, Message: "SIPLUS devices need an extended temperature range"},
+		{Rule: "axes-need-motion", Severity: model.SeverityWarning, Message: "device breaks rule axes-need-motion"},
+	}, findings)
+	assert.Len(t, lint.WithSeverity(findings, model.SeverityWarning), 1)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string][]lint.Config{
+		`rule 1 has no name`:                                              {{Severity: "error", Require: "failsafe"}},
+		`rule "a" is declared twice`:                                      {{Name: "a", Severity: "error", Require: "failsafe"}, {Name: "a", Severity: "error", Require: "failsafe"}},
+		`rule "a": severity must be error or warning, got ""`:             {{Name: "a", Require: "failsafe"}},
+		`rule "a" has no require expression`:                              {{Name: "a", Severity: "warning"}},
+		`rule "a" when: position 1: unknown field "color"`:                {{Name: "a", Severity: "warning", When: "color", Require: "failsafe"}},
+		`rule "a" require: position 10: expected value, got end of query`: {{Name: "a", Severity: "warning", Require: "tempMax >"}},
+	}
+	for want, configs := range tests {
+		_, err := lint.Compile(configs)
+		assert.EqualError(t, err, want)
+	}
+}
@@ -0,0 +1,290 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a single schema change. Up must be idempotent: replicas that
+// start at the same time may run it concurrently and only the first one gets
+// to record it.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, client database.DBClient) error
+}
+
+// Record is what gets stored in the migrations collection once a migration
+// has been applied.
+type Record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Status describes one known migration and whether it has been applied.
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Migrator applies migrations to the databases and collections selected by
+// the client's Names.
+type Migrator struct {
+	Client     database.DBClient
+	Migrations []Migration
+}
+
+// New returns a Migrator for every migration this build knows about.
+func New(client database.DBClient) Migrator {
+	return Migrator{Client: client, Migrations: All}
+}
+
+// Validate checks that versions are positive and strictly increasing.
+func (m Migrator) Validate() error {
+	last := 0
+	for _, mig := range m.Migrations {
+		if mig.Version <= last {
+			return fmt.Errorf("migration %d is out of order", mig.Version)
+		}
+		if mig.Up == nil {
+			return fmt.Errorf("migration %d has no Up function", mig.Version)
+		}
+		last = mig.Version
+	}
+	return nil
+}
+
+func (m Migrator) collection() *mongo.Collection {
+	return m.Client.MigrationCollection()
+}
+
+func (m Migrator) applied(ctx context.Context) (map[int]Record, error) {
+	cursor, err := m.collection().Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := make(map[int]Record)
+	for cursor.Next(ctx) {
+		var r Record
+		if err := cursor.Decode(&r); err != nil {
+			return nil, err
+		}
+		records[r.Version] = r
+	}
+	return records, cursor.Err()
+}
+
+// Pending returns the migrations that are not in applied, in order.
+func (m Migrator) Pending(applied map[int]Record) []Migration {
+	var pending []Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		r, ok := applied[mig.Version]
+		status = append(status, Status{
+			Version:     mig.Version,
+			Description: mig.Description,
+			Applied:     ok,
+			AppliedAt:   r.AppliedAt,
+		})
+	}
+	return status, nil
+}
+
+// Up applies all pending migrations in order and returns them. With dryRun
+// set nothing is changed and the pending migrations are only returned.
+func (m Migrator) Up(ctx context.Context, dryRun bool) ([]Migration, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := m.Pending(applied)
+	if dryRun {
+		return pending, nil
+	}
+
+	for i, mig := range pending {
+		if err := mig.Up(ctx, m.Client); err != nil {
+			return pending[:i], fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Description, err)
+		}
+
+		_, err := m.collection().InsertOne(ctx, Record{
+			Version:     mig.Version,
+			Description: mig.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return pending[:i], err
+		}
+		log.Println("Applied migration: ", mig.Version, " ", mig.Description)
+	}
+	return pending, nil
+}
+
+func createIndex(ctx context.Context, coll *mongo.Collection, model mongo.IndexModel) error {
+	_, err := coll.Indexes().CreateOne(ctx, model)
+	var cmdErr mongo.CommandError
+	// IndexOptionsConflict: an equivalent index already exists under another name.
+	if errors.As(err, &cmdErr) && cmdErr.Code == 85 {
+		return nil
+	}
+	return err
+}
+
+// All is the ordered list of migrations. Append new migrations to the end and
+// never change the version of a released one.
+var All = []Migration{
+	{
+		Version:     1,
+		Description: "unique index on users.username",
+		Up: func(ctx context.Context, client database.DBClient) error {
+			return createIndex(ctx, client.UserCollection(), mongo.IndexModel{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetName("username_unique").SetUnique(true),
+			})
+		},
+	},
+	{
+		Version:     2,
+		Description: "unique index on session.token",
+		Up: func(ctx context.Context, client database.DBClient) error {
+			return createIndex(ctx, client.SessionCollection(), mongo.IndexModel{
+				Keys:    bson.D{{Key: "token", Value: 1}},
+				Options: options.Index().SetName("token_unique").SetUnique(true),
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "ttl index on session.expiry",
+		Up: func(ctx context.Context, client database.DBClient) error {
+			return createIndex(ctx, client.SessionCollection(), mongo.IndexModel{
+				Keys:    bson.D{{Key: "expiry", Value: 1}},
+				Options: options.Index().SetName("expiry_ttl").SetExpireAfterSeconds(0),
+			})
+		},
+	},
+	{
+		Version:     4,
+		Description: "text index on devices.name and devices.devicetypeid",
+		Up: func(ctx context.Context, client database.DBClient) error {
+			// Language none keeps device codes like "ET" from being stemmed
+			// or dropped as stop words.
+			return createIndex(ctx, client.DeviceCollection(), mongo.IndexModel{
+				Keys: bson.D{{Key: "name", Value: "text"}, {Key: "devicetypeid", Value: "text"}},
+				Options: options.Index().SetName("name_type_text").
+					SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "devicetypeid", Value: 1}}).
+					SetDefaultLanguage("none"),
+			})
+		},
+	},
+	{
+		Version:     5,
+		Description: "index on devices.name for name suggestions",
+		Up: func(ctx context.Context, client database.DBClient) error {
+			return createIndex(ctx, client.DeviceCollection(), mongo.IndexModel{
+				Keys:    bson.D{{Key: "name", Value: 1}},
+				Options: options.Index().SetName("name"),
+			})
+		},
+	},
+	{
+		Version:     6,
+		Description: "convert ObjectID device ids to strings",
+		Up:          stringDeviceIDs,
+	},
+	{
+		Version:     7,
+		Description: "device types for the deviceTypeIds in use",
+		Up:          deviceTypesInUse,
+	},
+}
+
+// stringDeviceIDs rewrites devices stored with an ObjectID as _id to the hex
+// string of it. Responses already showed that string, so clients that kept it
+// can now fetch the device. Rerunning it finishes an interrupted conversion.
+func stringDeviceIDs(ctx context.Context, client database.DBClient) error {
+	coll := client.DeviceCollection()
+	cursor, err := coll.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$type", Value: "objectId"}}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		var oid primitive.ObjectID
+		for i, e := range doc {
+			if e.Key == "_id" {
+				oid = e.Value.(primitive.ObjectID)
+				doc[i].Value = oid.Hex()
+			}
+		}
+
+		_, err := coll.InsertOne(ctx, doc)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if _, err := coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: oid}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// deviceTypesInUse creates a device type named like its id for every
+// deviceTypeId that devices refer to, so they pass the type check on their
+// next write.
+func deviceTypesInUse(ctx context.Context, client database.DBClient) error {
+	ids, err := client.DeviceCollection().Distinct(ctx, "devicetypeid", bson.D{{Key: "devicetypeid", Value: bson.D{{Key: "$ne", Value: ""}}}})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_, err := client.DeviceTypeCollection().UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: id}},
+			bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "name", Value: id}, {Key: "description", Value: ""}}}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func noop(ctx context.Context, client database.DBClient) error { return nil }
+
+func TestAllMigrationsAreOrdered(t *testing.T) {
+	m := migrations.New(database.DBClient{})
+	assert.Nil(t, m.Validate())
+}
+
+func TestValidateRejectsOutOfOrder(t *testing.T) {
+	m := migrations.Migrator{Migrations: []migrations.Migration{
+		{Version: 2, Up: noop},
+		{Version: 1, Up: noop},
+	}}
+	assert.NotNil(t, m.Validate())
+}
+
+func TestPending(t *testing.T) {
+	m := migrations.Migrator{Migrations: []migrations.Migration{
+		{Version: 1, Up: noop},
+		{Version: 2, Up: noop},
+		{Version: 3, Up: noop},
+	}}
+	pending := m.Pending(map[int]migrations.Record{2: {Version: 2}})
+	assert.Len(t, pending, 2)
+	assert.Equal(t, 1, pending[0].Version)
+	assert.Equal(t, 3, pending[1].Version)
+}
@@ -0,0 +1,5 @@
+package planning
+
+// Candidates exposes the devices Suggest considers, whose number bounds its
+// work.
+var Candidates = candidates
@@ -0,0 +1,202 @@
+package planning
+
+import (
+	"sort"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MotionFilter selects the devices of the catalog that can close an axis
+// gap for GetDeviceDB: motion-enabled devices with at least one axis.
+func MotionFilter() bson.D {
+	return bson.D{
+		{Key: "motionenable", Value: bson.D{{Key: "$eq", Value: true}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "rotationaxisnumber", Value: bson.D{{Key: "$gt", Value: 0}}}},
+			bson.D{{Key: "positionaxisnumber", Value: bson.D{{Key: "$gt", Value: 0}}}},
+		}},
+	}
+}
+
+// Capacity adds up the axes of the selection in req and compares them with
+// the required ones. devices are the stored devices of the selection, lines
+// without one are reported as missing. Only motion-enabled devices provide
+// axes. Suggestions are left for the caller, Closable is set to Covered.
+func Capacity(req model.MotionRequirement, devices []model.Device) model.MotionCapacity {
+	byID := make(map[string]model.Device, len(devices))
+	for _, device := range devices {
+		byID[device.ID] = device
+	}
+
+	c := model.MotionCapacity{
+		RotationAxes:     model.AxisBalance{Required: req.RotationAxes},
+		PositionAxes:     model.AxisBalance{Required: req.PositionAxes},
+		Missing:          []string{},
+		NotMotionEnabled: []string{},
+		Suggestions:      []model.MotionSuggestion{},
+	}
+	reported := make(map[string]bool)
+	for _, line := range req.Devices {
+		device, ok := byID[line.DeviceID]
+		switch {
+		case !ok:
+			if !reported[line.DeviceID] {
+				c.Missing = append(c.Missing, line.DeviceID)
+			}
+		case !device.MotionEnable:
+			if !reported[line.DeviceID] {
+				c.NotMotionEnabled = append(c.NotMotionEnabled, line.DeviceID)
+			}
+		default:
+			c.RotationAxes.Available += line.Quantity * max(device.RotationAxisNumber, 0)
+			c.PositionAxes.Available += line.Quantity * max(device.PositionAxisNumber, 0)
+		}
+		reported[line.DeviceID] = true
+	}
+
+	c.RotationAxes.Margin = c.RotationAxes.Available - c.RotationAxes.Required
+	c.PositionAxes.Margin = c.PositionAxes.Available - c.PositionAxes.Required
+	c.Covered = c.RotationAxes.Margin >= 0 && c.PositionAxes.Margin >= 0
+	c.Closable = c.Covered
+	return c
+}
+
+// Suggest picks the fewest devices of catalog that together provide at least
+// rotation rotary and position positioning axes. Each device may be used
+// any number of times. Devices another one beats in both axes are left out,
+// among equally small picks of the others it prefers the one with the
+// fewest surplus axes, then devices that come first in catalog. It reports
+// false when catalog cannot provide enough axes.
+func Suggest(rotation, position int, catalog []model.Device) ([]model.MotionSuggestion, bool) {
+	rotation, position = max(rotation, 0), max(position, 0)
+	candidates := candidates(rotation, position, catalog)
+
+	// best[r][p] is the cheapest pick that provides r rotary and p
+	// positioning axes. Every device lowers at least one of them, so the
+	// rest of a pick always has a lower index and is known already.
+	type pick struct {
+		ok        bool
+		count     int
+		axes      int
+		candidate int
+	}
+	best := make([][]pick, rotation+1)
+	for r := range best {
+		best[r] = make([]pick, position+1)
+	}
+	best[0][0] = pick{ok: true}
+	for r := 0; r <= rotation; r++ {
+		for p := 0; p <= position; p++ {
+			if r == 0 && p == 0 {
+				continue
+			}
+			for i, device := range candidates {
+				rr := max(r-device.RotationAxisNumber, 0)
+				pp := max(p-device.PositionAxisNumber, 0)
+				rest := best[rr][pp]
+				if (rr == r && pp == p) || !rest.ok {
+					continue
+				}
+				next := pick{
+					ok:        true,
+					count:     rest.count + 1,
+					axes:      rest.axes + device.RotationAxisNumber + device.PositionAxisNumber,
+					candidate: i,
+				}
+				cur := best[r][p]
+				if !cur.ok || next.count < cur.count || next.count == cur.count && next.axes < cur.axes {
+					best[r][p] = next
+				}
+			}
+		}
+	}
+	if !best[rotation][position].ok {
+		return []model.MotionSuggestion{}, false
+	}
+
+	quantities := make([]int, len(candidates))
+	for r, p := rotation, position; r > 0 || p > 0; {
+		device := candidates[best[r][p].candidate]
+		quantities[best[r][p].candidate]++
+		r, p = max(r-device.RotationAxisNumber, 0), max(p-device.PositionAxisNumber, 0)
+	}
+	suggestions := []model.MotionSuggestion{}
+	for i, n := range quantities {
+		if n == 0 {
+			continue
+		}
+		device := candidates[i]
+		suggestions = append(suggestions, model.MotionSuggestion{
+			DeviceID:     device.ID,
+			Name:         device.Name,
+			Quantity:     n,
+			RotationAxes: n * device.RotationAxisNumber,
+			PositionAxes: n * device.PositionAxisNumber,
+		})
+	}
+	return suggestions, true
+}
+
+// candidates returns the motion-enabled devices of catalog worth picking for
+// Suggest, in catalog order and with negative axes counted as none. Axes
+// beyond the requirement do not help, so they are cut off before devices
+// are compared. A pick can always swap a device for one with at least as
+// many cut-off axes of both kinds and stay as small, so only devices no
+// other one matches in both are kept. Of devices with the same cut-off axes
+// the one with the fewest axes, then the first one, stands for all. That
+// leaves at most min(rotation, position)+1 candidates, which bounds the work
+// of Suggest.
+func candidates(rotation, position int, catalog []model.Device) []model.Device {
+	type candidate struct {
+		device model.Device
+		index  int
+		r, p   int
+	}
+	best := make(map[[2]int]candidate)
+	for i, device := range catalog {
+		device.RotationAxisNumber = max(device.RotationAxisNumber, 0)
+		device.PositionAxisNumber = max(device.PositionAxisNumber, 0)
+		c := candidate{device: device, index: i,
+			r: min(device.RotationAxisNumber, rotation),
+			p: min(device.PositionAxisNumber, position)}
+		if !device.MotionEnable || c.r == 0 && c.p == 0 {
+			continue
+		}
+		key := [2]int{c.r, c.p}
+		if prev, ok := best[key]; !ok || axes(device) < axes(prev.device) {
+			best[key] = c
+		}
+	}
+
+	// Going from most to fewest rotary axes, a device is only kept if it has
+	// more positioning axes than every device before it.
+	list := make([]candidate, 0, len(best))
+	for _, c := range best {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].r != list[j].r {
+			return list[i].r > list[j].r
+		}
+		return list[i].p > list[j].p
+	})
+	kept := list[:0]
+	for _, c := range list {
+		if len(kept) == 0 || c.p > kept[len(kept)-1].p {
+			kept = append(kept, c)
+		}
+	}
+
+	sort.Slice(kept, func(i, j int) bool { return kept[i].index < kept[j].index })
+	devices := make([]model.Device, len(kept))
+	for i, c := range kept {
+		devices[i] = c.device
+	}
+	return devices
+}
+
+func axes(device model.Device) int {
+	return device.RotationAxisNumber + device.PositionAxisNumber
+}
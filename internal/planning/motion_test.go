@@ -0,0 +1,108 @@
+package planning_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/planning"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapacity(t *testing.T) {
+	c := planning.Capacity(model.MotionRequirement{
+		Devices: []model.MotionLine{
+			{DeviceID: "a", Quantity: 2},
+			{DeviceID: "b", Quantity: 1},
+			{DeviceID: "a", Quantity: 1},
+			{DeviceID: "x", Quantity: 3},
+		},
+		RotationAxes: 6,
+		PositionAxes: 4,
+	}, []model.Device{
+		{ID: "a", MotionEnable: true, RotationAxisNumber: 2, PositionAxisNumber: 1},
+		{ID: "b", RotationAxisNumber: 8},
+	})
+	assert.Equal(t, model.AxisBalance{Required: 6, Available: 6, Margin: 0}, c.RotationAxes)
+	assert.Equal(t, model.AxisBalance{Required: 4, Available: 3, Margin: -1}, c.PositionAxes)
+	assert.False(t, c.Covered)
+	assert.False(t, c.Closable)
+	assert.Equal(t, []string{"x"}, c.Missing)
+	assert.Equal(t, []string{"b"}, c.NotMotionEnabled)
+}
+
+func TestSuggest(t *testing.T) {
+	catalog := []model.Device{
+		{ID: "a", MotionEnable: true, RotationAxisNumber: 1},
+		{ID: "b", MotionEnable: true, RotationAxisNumber: 4, PositionAxisNumber: 4},
+		{ID: "c", MotionEnable: true, RotationAxisNumber: 3},
+		{ID: "d", MotionEnable: true, RotationAxisNumber: 3},
+		{ID: "e", RotationAxisNumber: 64, PositionAxisNumber: 64},
+	}
+
+	// One b would do, without it two devices are the fewest. a has fewer
+	// axes than c in both kinds and d only repeats the axes of c.
+	suggestions, ok := planning.Suggest(4, 0, catalog)
+	assert.True(t, ok)
+	assert.Equal(t, []model.MotionSuggestion{
+		{DeviceID: "b", Quantity: 1, RotationAxes: 4, PositionAxes: 4},
+	}, suggestions)
+
+	suggestions, ok = planning.Suggest(4, 0, append(catalog[:1:1], catalog[2:]...))
+	assert.True(t, ok)
+	assert.Equal(t, []model.MotionSuggestion{
+		{DeviceID: "c", Quantity: 2, RotationAxes: 6},
+	}, suggestions)
+
+	// With 3 rotary axes required c and d cover as much as b, c wins by
+	// having fewer axes.
+	suggestions, ok = planning.Suggest(3, 0, catalog)
+	assert.True(t, ok)
+	assert.Equal(t, []model.MotionSuggestion{
+		{DeviceID: "c", Quantity: 1, RotationAxes: 3},
+	}, suggestions)
+
+	suggestions, ok = planning.Suggest(5, 7, catalog)
+	assert.True(t, ok)
+	assert.Equal(t, []model.MotionSuggestion{
+		{DeviceID: "b", Quantity: 2, RotationAxes: 8, PositionAxes: 8},
+	}, suggestions)
+
+	suggestions, ok = planning.Suggest(0, 0, catalog)
+	assert.True(t, ok)
+	assert.Empty(t, suggestions)
+
+	suggestions, ok = planning.Suggest(0, 1, catalog[:1])
+	assert.False(t, ok)
+	assert.Empty(t, suggestions)
+}
+
+func TestSuggestLargeCatalog(t *testing.T) {
+	// Every axis pair up to 64 axes in all, where the devices with exactly
+	// 64 form a staircase none of which beats another in both kinds, and
+	// the largest requirement.
+	var catalog []model.Device
+	for r := 0; r <= 64; r++ {
+		for p := 0; p <= 64; p++ {
+			if r+p < 64 {
+				catalog = append(catalog, model.Device{ID: fmt.Sprintf("%d-%d", r, p), MotionEnable: true, RotationAxisNumber: r, PositionAxisNumber: p})
+			}
+		}
+		catalog = append(catalog, model.Device{ID: fmt.Sprintf("stair-%d", r), MotionEnable: true, RotationAxisNumber: r, PositionAxisNumber: 64 - r})
+	}
+
+	// Only the staircase is left to pick from, the work of Suggest grows
+	// with the number of candidates times the requirement.
+	assert.Len(t, planning.Candidates(256, 256, catalog), 65)
+	assert.Len(t, planning.Candidates(4, 256, catalog), 5)
+
+	suggestions, ok := planning.Suggest(256, 256, catalog)
+	assert.True(t, ok)
+	rotation, position, count := 0, 0, 0
+	for _, s := range suggestions {
+		rotation, position, count = rotation+s.RotationAxes, position+s.PositionAxes, count+s.Quantity
+	}
+	assert.Equal(t, 8, count)
+	assert.GreaterOrEqual(t, rotation, 256)
+	assert.GreaterOrEqual(t, position, 256)
+}
@@ -0,0 +1,156 @@
+// Package planning works out which devices can run together in an
+// enclosure.
+package planning
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Filter selects the devices that can run in env for GetDeviceDB. Their
+// temperature range has to cover the ambient range, their installation
+// position has to be the one of env or empty, and in a 19 inch cabinet they
+// have to fit one. env needs both ambient temperatures.
+func Filter(env model.Environment) bson.D {
+	filter := bson.D{
+		{Key: "tempmin", Value: bson.D{{Key: "$lte", Value: *env.AmbientMin}}},
+		{Key: "tempmax", Value: bson.D{{Key: "$gte", Value: *env.AmbientMax}}},
+	}
+	if env.InstallationPosition != "" {
+		filter = append(filter, bson.E{Key: "installationposition", Value: bson.D{{Key: "$in", Value: bson.A{env.InstallationPosition, ""}}}})
+	}
+	if env.InsertInto19InchCabinet {
+		filter = append(filter, bson.E{Key: "insertinto19inchcabinet", Value: bson.D{{Key: "$eq", Value: true}}})
+	}
+	return filter
+}
+
+// Envelope combines the operating ranges of devices and lists the conflicts
+// among them and with env. Missing is left for the caller.
+func Envelope(env model.Environment, devices []model.Device) model.OperatingEnvelope {
+	e := model.OperatingEnvelope{
+		Devices:                 make([]string, len(devices)),
+		Missing:                 []string{},
+		InsertInto19InchCabinet: len(devices) > 0,
+		Conflicts:               []model.EnvelopeConflict{},
+	}
+	for i, device := range devices {
+		e.Devices[i] = device.ID
+		e.InsertInto19InchCabinet = e.InsertInto19InchCabinet && device.InsertInto19InchCabinet
+	}
+	if len(devices) == 0 {
+		return e
+	}
+
+	temperatures(&e, env, devices)
+	positions(&e, env, devices)
+	if env.InsertInto19InchCabinet {
+		var unfit []string
+		for _, device := range devices {
+			if !device.InsertInto19InchCabinet {
+				unfit = append(unfit, device.ID)
+			}
+		}
+		addConflict(&e, model.ConflictCabinet, unfit, "cannot be inserted into a 19 inch cabinet")
+	}
+	e.Suitable = len(e.Conflicts) == 0
+	return e
+}
+
+// temperatures sets the intersection of the temperature ranges or reports
+// the two devices that keep it empty, and the devices that do not cover the
+// ambient range of env.
+func temperatures(e *model.OperatingEnvelope, env model.Environment, devices []model.Device) {
+	// warmest needs the highest minimum, coolest has the lowest maximum.
+	warmest, coolest := devices[0], devices[0]
+	for _, device := range devices[1:] {
+		if device.TempMin > warmest.TempMin {
+			warmest = device
+		}
+		if device.TempMax < coolest.TempMax {
+			coolest = device
+		}
+	}
+	if warmest.TempMin <= coolest.TempMax {
+		e.TempMin, e.TempMax = &warmest.TempMin, &coolest.TempMax
+	} else {
+		e.Conflicts = append(e.Conflicts, model.EnvelopeConflict{
+			Kind:    model.ConflictTemperature,
+			Devices: []string{warmest.ID, coolest.ID},
+			Message: fmt.Sprintf("%s needs at least %d °C but %s tolerates at most %d °C",
+				warmest.ID, warmest.TempMin, coolest.ID, coolest.TempMax),
+		})
+	}
+
+	if env.AmbientMin == nil || env.AmbientMax == nil {
+		return
+	}
+	var narrow []string
+	for _, device := range devices {
+		if device.TempMin > *env.AmbientMin || device.TempMax < *env.AmbientMax {
+			narrow = append(narrow, device.ID)
+		}
+	}
+	addConflict(e, model.ConflictTemperature, narrow,
+		fmt.Sprintf("cannot run at the ambient range of %d to %d °C", *env.AmbientMin, *env.AmbientMax))
+}
+
+// positions sets the common installation position or reports devices that
+// need different ones, and the devices that cannot be mounted like env.
+func positions(e *model.OperatingEnvelope, env model.Environment, devices []model.Device) {
+	byPosition := make(map[string][]string)
+	var mounted, wrong []string
+	for _, device := range devices {
+		p := device.InstallationPosition
+		if p == "" {
+			continue
+		}
+		byPosition[p] = append(byPosition[p], device.ID)
+		mounted = append(mounted, device.ID)
+		if env.InstallationPosition != "" && p != env.InstallationPosition {
+			wrong = append(wrong, device.ID)
+		}
+	}
+
+	names := make([]string, 0, len(byPosition))
+	for p := range byPosition {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+	case 1:
+		e.InstallationPosition = names[0]
+	default:
+		groups := make([]string, len(names))
+		for i, p := range names {
+			groups[i] = fmt.Sprintf("%s (%s)", p, strings.Join(byPosition[p], ", "))
+		}
+		e.Conflicts = append(e.Conflicts, model.EnvelopeConflict{
+			Kind:    model.ConflictInstallationPosition,
+			Devices: mounted,
+			Message: "devices need different installation positions: " + strings.Join(groups, ", "),
+		})
+	}
+
+	addConflict(e, model.ConflictInstallationPosition, wrong,
+		fmt.Sprintf("cannot be mounted %s", env.InstallationPosition))
+}
+
+// addConflict adds a conflict of kind for devices, if there are any. Their
+// ids are appended to the message.
+func addConflict(e *model.OperatingEnvelope, kind string, devices []string, msg string) {
+	if len(devices) == 0 {
+		return
+	}
+	e.Conflicts = append(e.Conflicts, model.EnvelopeConflict{
+		Kind:    kind,
+		Devices: devices,
+		Message: msg + ": " + strings.Join(devices, ", "),
+	})
+}
@@ -0,0 +1,62 @@
+package planning_test
+
+import (
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/planning"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func ambient(lo, hi int) model.Environment {
+	return model.Environment{AmbientMin: &lo, AmbientMax: &hi}
+}
+
+func TestFilter(t *testing.T) {
+	env := ambient(-10, 50)
+	env.InstallationPosition = "horizontal"
+	env.InsertInto19InchCabinet = true
+	assert.Equal(t, bson.D{
+		{Key: "tempmin", Value: bson.D{{Key: "$lte", Value: -10}}},
+		{Key: "tempmax", Value: bson.D{{Key: "$gte", Value: 50}}},
+		{Key: "installationposition", Value: bson.D{{Key: "$in", Value: bson.A{"horizontal", ""}}}},
+		{Key: "insertinto19inchcabinet", Value: bson.D{{Key: "$eq", Value: true}}},
+	}, planning.Filter(env))
+}
+
+func TestEnvelope(t *testing.T) {
+	devices := []model.Device{
+		{ID: "a", TempMin: -25, TempMax: 60, InstallationPosition: "horizontal", InsertInto19InchCabinet: true},
+		{ID: "b", TempMin: 0, TempMax: 55, InsertInto19InchCabinet: true},
+	}
+	e := planning.Envelope(ambient(5, 50), devices)
+	assert.True(t, e.Suitable)
+	assert.Equal(t, 0, *e.TempMin)
+	assert.Equal(t, 55, *e.TempMax)
+	assert.Equal(t, "horizontal", e.InstallationPosition)
+	assert.True(t, e.InsertInto19InchCabinet)
+	assert.Empty(t, e.Conflicts)
+}
+
+func TestEnvelopeConflicts(t *testing.T) {
+	env := ambient(-10, 50)
+	env.InstallationPosition = "vertical"
+	env.InsertInto19InchCabinet = true
+	e := planning.Envelope(env, []model.Device{
+		{ID: "a", TempMin: -25, TempMax: 60, InstallationPosition: "horizontal", InsertInto19InchCabinet: true},
+		{ID: "b", TempMin: 65, TempMax: 85, InstallationPosition: "vertical"},
+	})
+	assert.False(t, e.Suitable)
+	assert.Nil(t, e.TempMin)
+	assert.Nil(t, e.TempMax)
+	assert.Equal(t, "", e.InstallationPosition)
+	assert.False(t, e.InsertInto19InchCabinet)
+	assert.Equal(t, []model.EnvelopeConflict{
+		{Kind: model.ConflictTemperature, Devices: []string{"b", "a"}, Message: "b needs at least 65 °C but a tolerates at most 60 °C"},
+		{Kind: model.ConflictTemperature, Devices: []string{"b"}, Message: "cannot run at the ambient range of -10 to 50 °C: b"},
+		{Kind: model.ConflictInstallationPosition, Devices: []string{"a", "b"}, Message: "devices need different installation positions: horizontal (a), vertical (b)"},
+		{Kind: model.ConflictInstallationPosition, Devices: []string{"a"}, Message: "cannot be mounted vertical: a"},
+		{Kind: model.ConflictCabinet, Devices: []string{"b"}, Message: "cannot be inserted into a 19 inch cabinet: b"},
+	}, e.Conflicts)
+}
@@ -0,0 +1,411 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// An expression filters devices with a small boolean language:
+//
+//	expr       = term { "or" term }
+//	term       = factor { "and" factor }
+//	factor     = "not" factor | "(" expr ")" | comparison | field
+//	comparison = field ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) value
+//	           | field "in" "(" value { "," value } ")"
+//	value      = number | string | "true" | "false"
+//
+// Fields are the JSON names of model.Device, a boolean field on its own means
+// field == true. Attributes are compared by path, like attributes.ports >= 8,
+// and take values of any type. Strings are quoted with " or '. Keywords are
+// lower case.
+// Example: (failsafe and tempMax >= 70) or siplusCatalog
+
+// Expr is a parsed and type-checked expression.
+type Expr interface {
+	// Filter compiles the expression to a filter for GetDeviceDB.
+	Filter() bson.D
+}
+
+// Logical combines expressions with "and" or "or".
+type Logical struct {
+	Op    string
+	Exprs []Expr
+}
+
+// Not negates an expression.
+type Not struct {
+	Expr Expr
+}
+
+// Compare compares a field with one value, or with a list for "in".
+type Compare struct {
+	Field string
+	Op    string
+	Value interface{}
+
+	key string
+}
+
+func (e Logical) Filter() bson.D {
+	clauses := make(bson.A, len(e.Exprs))
+	for i, x := range e.Exprs {
+		clauses[i] = x.Filter()
+	}
+	return bson.D{{Key: "$" + e.Op, Value: clauses}}
+}
+
+func (e Not) Filter() bson.D {
+	return bson.D{{Key: "$nor", Value: bson.A{e.Expr.Filter()}}}
+}
+
+var compareOperators = map[string]string{
+	"==": "$eq",
+	"!=": "$ne",
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+	"in": "$in",
+}
+
+func (e Compare) Filter() bson.D {
+	return bson.D{{Key: e.key, Value: bson.D{{Key: compareOperators[e.Op], Value: e.Value}}}}
+}
+
+// ExprError is an error at a position of an expression. Pos counts
+// characters starting at 1.
+type ExprError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// Limits of an expression. The parser recurses for every "not" and "(", the
+// depth bounds its stack no matter how long the input is.
+const (
+	MaxExprLength = 4096
+	MaxExprDepth  = 32
+)
+
+// ParseExpr parses src and checks it against the fields of model.Device.
+func ParseExpr(src string) (Expr, error) {
+	if utf8.RuneCountInString(src) > MaxExprLength {
+		return nil, &ExprError{Pos: MaxExprLength + 1, Msg: fmt.Sprintf("query is longer than %d characters", MaxExprLength)}
+	}
+	p := &parser{src: []rune(src)}
+	p.next()
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s", p.tok)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	src []rune
+	off int
+	tok token
+	err *ExprError
+	// depth counts the factors being parsed, see MaxExprDepth.
+	depth int
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) *ExprError {
+	return &ExprError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next reads the following token into p.tok. Lexing errors are kept in
+// p.err and reported by the parser before it looks at the token.
+func (p *parser) next() {
+	for p.off < len(p.src) && unicode.IsSpace(p.src[p.off]) {
+		p.off++
+	}
+	start := p.off
+	pos := start + 1
+	if p.off >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: pos}
+		return
+	}
+
+	c := p.src[p.off]
+	switch {
+	case c == '(':
+		p.off++
+		p.tok = token{kind: tokLParen, text: "(", pos: pos}
+	case c == ')':
+		p.off++
+		p.tok = token{kind: tokRParen, text: ")", pos: pos}
+	case c == ',':
+		p.off++
+		p.tok = token{kind: tokComma, text: ",", pos: pos}
+	case strings.ContainsRune("=!<>", c):
+		p.off++
+		if p.off < len(p.src) && p.src[p.off] == '=' {
+			p.off++
+		}
+		text := string(p.src[start:p.off])
+		if text == "=" || text == "!" {
+			p.err = p.errorf(pos, "unknown operator %q, did you mean %q", text, text+"=")
+		}
+		p.tok = token{kind: tokOp, text: text, pos: pos}
+	case c == '"' || c == '\'':
+		p.off++
+		var b strings.Builder
+		for {
+			if p.off >= len(p.src) {
+				p.err = p.errorf(pos, "unterminated string")
+				break
+			}
+			r := p.src[p.off]
+			p.off++
+			if r == c {
+				break
+			}
+			if r == '\\' && p.off < len(p.src) {
+				r = p.src[p.off]
+				p.off++
+			}
+			b.WriteRune(r)
+		}
+		p.tok = token{kind: tokString, text: b.String(), pos: pos}
+	case c == '-' || unicode.IsDigit(c):
+		p.off++
+		for p.off < len(p.src) && unicode.IsDigit(p.src[p.off]) {
+			p.off++
+		}
+		p.tok = token{kind: tokNumber, text: string(p.src[start:p.off]), pos: pos}
+	case unicode.IsLetter(c) || c == '_':
+		for p.off < len(p.src) && (unicode.IsLetter(p.src[p.off]) || unicode.IsDigit(p.src[p.off]) || strings.ContainsRune("_.", p.src[p.off])) {
+			p.off++
+		}
+		p.tok = token{kind: tokIdent, text: string(p.src[start:p.off]), pos: pos}
+	default:
+		p.off++
+		p.err = p.errorf(pos, "unexpected character %q", c)
+		p.tok = token{kind: tokEOF, pos: pos}
+	}
+}
+
+func (p *parser) keyword(word string) bool {
+	return p.tok.kind == tokIdent && p.tok.text == word
+}
+
+func (p *parser) expr() (Expr, error) {
+	return p.logical("or", p.term)
+}
+
+func (p *parser) term() (Expr, error) {
+	return p.logical("and", p.factor)
+}
+
+func (p *parser) logical(op string, operand func() (Expr, error)) (Expr, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{first}
+	for p.keyword(op) {
+		p.next()
+		e, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 1 {
+		return first, nil
+	}
+	return Logical{Op: op, Exprs: exprs}, nil
+}
+
+func (p *parser) factor() (Expr, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxExprDepth {
+		return nil, p.errorf(p.tok.pos, "query is nested deeper than %d levels", MaxExprDepth)
+	}
+
+	switch {
+	case p.keyword("not"):
+		p.next()
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: e}, nil
+	case p.tok.kind == tokLParen:
+		open := p.tok.pos
+		p.next()
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf(p.tok.pos, "expected \")\" to close \"(\" at position %d, got %s", open, p.tok)
+		}
+		p.next()
+		return e, nil
+	case p.tok.kind == tokIdent && !isKeyword(p.tok.text):
+		return p.comparison()
+	}
+	return nil, p.errorf(p.tok.pos, "expected field, \"not\" or \"(\", got %s", p.tok)
+}
+
+func (p *parser) comparison() (Expr, error) {
+	name := p.tok
+	f, err := lookupPath(name.text)
+	if err != nil {
+		return nil, p.errorf(name.pos, "%s", err)
+	}
+	p.next()
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	cmp := Compare{Field: f.name, key: f.key}
+	switch {
+	case p.tok.kind == tokOp:
+		cmp.Op = p.tok.text
+	case p.keyword("in"):
+		cmp.Op = "in"
+	default:
+		if f.kind != reflect.Bool {
+			return nil, p.errorf(p.tok.pos, "expected operator after %s, got %s", f.name, p.tok)
+		}
+		cmp.Op, cmp.Value = "==", true
+		return cmp, nil
+	}
+	op := p.tok
+	if op.text != "==" && op.text != "!=" && op.text != "in" && !f.ordered() {
+		return nil, p.errorf(op.pos, "operator %q needs a number field, %s is not", op.text, f.name)
+	}
+	p.next()
+
+	if cmp.Op != "in" {
+		cmp.Value, err = p.value(f)
+		return cmp, err
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf(p.tok.pos, "expected \"(\" after in, got %s", p.tok)
+	}
+	p.next()
+	var list bson.A
+	for {
+		v, err := p.value(f)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if p.err != nil {
+			return nil, p.err
+		}
+		if p.tok.kind == tokRParen {
+			p.next()
+			break
+		}
+		if p.tok.kind != tokComma {
+			return nil, p.errorf(p.tok.pos, "expected \",\" or \")\", got %s", p.tok)
+		}
+		p.next()
+	}
+	cmp.Value = list
+	return cmp, nil
+}
+
+// value reads a literal and checks that it has the type of f.
+func (p *parser) value(f field) (interface{}, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	var v interface{}
+	switch {
+	case tok.kind == tokNumber:
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "invalid number %q", tok.text)
+		}
+		v = n
+	case tok.kind == tokString:
+		v = tok.text
+	case p.keyword("true"), p.keyword("false"):
+		v = tok.text == "true"
+	default:
+		return nil, p.errorf(tok.pos, "expected value, got %s", tok)
+	}
+
+	if f.kind != reflect.Interface && reflect.TypeOf(v).Kind() != f.kind {
+		return nil, p.errorf(tok.pos, "%s is a %s field, got %s", f.name, kindName(f.kind), tok)
+	}
+	p.next()
+	return v, nil
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "and", "or", "not", "in", "true", "false":
+		return true
+	}
+	return false
+}
+
+func kindName(k reflect.Kind) string {
+	switch k {
+	case reflect.Int:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return k.String()
+}
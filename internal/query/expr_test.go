@@ -0,0 +1,60 @@
+package query_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseExpr(t *testing.T) {
+	e, err := query.ParseExpr(`(failsafe and tempMax>=70) or siplusCatalog`)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "$and", Value: bson.A{
+			bson.D{{Key: "failsafe", Value: bson.D{{Key: "$eq", Value: true}}}},
+			bson.D{{Key: "tempmax", Value: bson.D{{Key: "$gte", Value: 70}}}},
+		}}},
+		bson.D{{Key: "sipluscatalog", Value: bson.D{{Key: "$eq", Value: true}}}},
+	}}}, e.Filter())
+
+	e, err = query.ParseExpr(`not name in ("S7-1500", 'ET 200SP') and tempMin > -10`)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$nor", Value: bson.A{
+			bson.D{{Key: "name", Value: bson.D{{Key: "$in", Value: bson.A{"S7-1500", "ET 200SP"}}}}},
+		}}},
+		bson.D{{Key: "tempmin", Value: bson.D{{Key: "$gt", Value: -10}}}},
+	}}}, e.Filter())
+
+	e, err = query.ParseExpr(`attributes.ports >= 8 and attributes.vendor.code in ("SI", 'SZ')`)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "attributes.ports", Value: bson.D{{Key: "$gte", Value: 8}}}},
+		bson.D{{Key: "attributes.vendor.code", Value: bson.D{{Key: "$in", Value: bson.A{"SI", "SZ"}}}}},
+	}}}, e.Filter())
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := map[string]string{
+		`color == "red"`:                  `position 1: unknown field "color"`,
+		`failsafe and`:                    `position 13: expected field, "not" or "(", got end of query`,
+		`(failsafe or siplusCatalog`:      `position 27: expected ")" to close "(" at position 1, got end of query`,
+		`tempMax >= "hot"`:                `position 12: tempMax is a number field, got "hot"`,
+		`name > "a"`:                      `position 6: operator ">" needs a number field, name is not`,
+		`tempMax = 60`:                    `position 9: unknown operator "=", did you mean "=="`,
+		`name == "S7`:                     `position 9: unterminated string`,
+		`tempMax`:                         `position 8: expected operator after tempMax, got end of query`,
+		`failsafe siplusCatalog`:          `position 10: unexpected "siplusCatalog"`,
+		`failsafe and tempMax > 1 # note`: `position 26: unexpected character '#'`,
+		strings.Repeat("(", 40) + "failsafe" + strings.Repeat(")", 40): `position 33: query is nested deeper than 32 levels`,
+		strings.Repeat("not ", 40) + "failsafe":                        `position 129: query is nested deeper than 32 levels`,
+		strings.Repeat("failsafe or ", 400) + "failsafe":               `position 4097: query is longer than 4096 characters`,
+	}
+	for src, want := range tests {
+		_, err := query.ParseExpr(src)
+		assert.EqualError(t, err, want, src)
+	}
+}
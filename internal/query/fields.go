@@ -0,0 +1,86 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+)
+
+// field is a model.Device field that can be filtered and sorted on.
+type field struct {
+	// name is the JSON name used in query parameters.
+	name string
+	// key is the document key in the stores.
+	key string
+	// index is the position in model.Device.
+	index int
+	kind  reflect.Kind
+}
+
+// fields maps the JSON names of model.Device to their fields. ID is exposed
+// as id.
+var fields = deviceFields()
+
+func deviceFields() map[string]field {
+	t := reflect.TypeOf(model.Device{})
+	m := make(map[string]field, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "_id" {
+			name = "id"
+		}
+		if name == "" {
+			name = f.Name
+		}
+		m[name] = field{name: name, key: key, index: i, kind: f.Type.Kind()}
+	}
+	return m
+}
+
+// attributesName is the JSON name of model.Device.Attributes. Filters reach
+// into the attributes with paths like attributes.ports.
+const attributesName = "attributes"
+
+func lookupField(name string) (field, error) {
+	f, ok := fields[name]
+	if !ok {
+		return f, fmt.Errorf("%s %q", ErrUnknownField, name)
+	}
+	return f, nil
+}
+
+// value returns the field of device.
+func (f field) value(device model.Device) interface{} {
+	return reflect.ValueOf(device).Field(f.index).Interface()
+}
+
+// lookupPath is lookupField for filters, it also accepts attribute paths.
+// Attributes have no fixed type, their kind is reflect.Interface.
+func lookupPath(name string) (field, error) {
+	path, ok := strings.CutPrefix(name, attributesName+".")
+	if !ok {
+		f, err := lookupField(name)
+		if err == nil && f.kind == reflect.Map {
+			return f, fmt.Errorf("%s, use a path like %s.ports", ErrAttributesPath, name)
+		}
+		return f, err
+	}
+	for _, part := range strings.Split(path, ".") {
+		if part == "" || strings.HasPrefix(part, "$") {
+			return field{}, fmt.Errorf("%s %q", ErrUnknownField, name)
+		}
+	}
+	return field{name: name, key: fields[attributesName].key + "." + path, index: -1, kind: reflect.Interface}, nil
+}
+
+// ordered reports whether f can be compared with <, <=, > and >=.
+func (f field) ordered() bool {
+	return f.kind == reflect.Int || f.kind == reflect.Interface
+}
@@ -0,0 +1,143 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// rangeOperators are the suffixes allowed on number fields, tempMax.gte=60
+// becomes {tempmax: {$gte: 60}}.
+var rangeOperators = map[string]string{
+	"gt":  "$gt",
+	"gte": "$gte",
+	"lt":  "$lt",
+	"lte": "$lte",
+}
+
+// ParseFilter translates filter parameters into a filter for GetDeviceDB.
+// Every field of model.Device can be compared for equality, a field given
+// several times matches any of the values. Number fields also take the
+// range operators gt, gte, lt and lte. Parameters in reserved are skipped,
+// any other parameter is an error. Values are converted to the type of the
+// field and never interpreted as operators.
+//
+// Attributes are filtered by path, like attributes.vendor.code=SI or
+// attributes.ports.gte=8. Their values have no fixed type: true, false and
+// numbers are compared as such, and for equality also as the string.
+func ParseFilter(values url.Values, reserved ...string) (bson.D, error) {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	filter := bson.D{}
+	conds := make(map[string]bson.D)
+	for _, param := range params {
+		if contains(reserved, param) {
+			continue
+		}
+
+		f, op, hasOp, err := filterParam(param)
+		if err != nil {
+			return nil, err
+		}
+
+		vals := make(bson.A, 0, len(values[param]))
+		for _, raw := range values[param] {
+			v, err := f.parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+			if _, ok := v.(string); !ok && f.kind == reflect.Interface && !hasOp {
+				vals = append(vals, raw)
+			}
+		}
+
+		var cond bson.E
+		switch {
+		case !hasOp && len(vals) == 1:
+			cond = bson.E{Key: "$eq", Value: vals[0]}
+		case !hasOp:
+			cond = bson.E{Key: "$in", Value: vals}
+		case !f.ordered() || rangeOperators[op] == "":
+			return nil, fmt.Errorf("%s %q", ErrInvalidOperator, param)
+		case len(vals) > 1:
+			return nil, fmt.Errorf("%s %q", ErrRepeatedParameter, param)
+		default:
+			cond = bson.E{Key: rangeOperators[op], Value: vals[0]}
+		}
+
+		if _, ok := conds[f.key]; !ok {
+			filter = append(filter, bson.E{Key: f.key})
+		}
+		conds[f.key] = append(conds[f.key], cond)
+	}
+
+	for i := range filter {
+		filter[i].Value = conds[filter[i].Key]
+	}
+	return filter, nil
+}
+
+// filterParam splits a filter parameter into the field and the operator.
+// On attribute paths only a range operator as last part is an operator,
+// the other parts are the path.
+func filterParam(param string) (f field, op string, hasOp bool, err error) {
+	name := param
+	if strings.HasPrefix(param, attributesName+".") {
+		if i := strings.LastIndex(param, "."); i > len(attributesName) && rangeOperators[param[i+1:]] != "" {
+			name, op, hasOp = param[:i], param[i+1:], true
+		}
+	} else {
+		name, op, hasOp = strings.Cut(param, ".")
+	}
+	f, err = lookupPath(name)
+	return f, op, hasOp, err
+}
+
+// parse converts a query parameter to the type of f.
+func (f field) parse(raw string) (interface{}, error) {
+	switch f.kind {
+	case reflect.Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q for %s, expected true or false", ErrInvalidValue, raw, f.name)
+		}
+		return v, nil
+	case reflect.Int:
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q for %s, expected a number", ErrInvalidValue, raw, f.name)
+		}
+		return v, nil
+	case reflect.Interface:
+		if raw == "true" || raw == "false" {
+			return raw == "true", nil
+		}
+		if v, err := strconv.Atoi(raw); err == nil {
+			return v, nil
+		}
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return v, nil
+		}
+	}
+	return raw, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// DefaultMaxPageSize is used when the server does not configure one.
+const DefaultMaxPageSize = 100
+
+// Cursor is the position after the last device of a page. Clients only ever
+// see it encoded and hand it back unchanged.
+type Cursor struct {
+	// Sort is the sort order the cursor was created for.
+	Sort string `json:"s"`
+	// Values are the sort key values of the last device.
+	Values []interface{} `json:"v"`
+}
+
+// Encode returns the opaque token for c.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a token returned by Encode for a list sorted by keys.
+// The values are converted to the types of the sort keys, so a forged token
+// cannot smuggle anything but plain values into the filter.
+func DecodeCursor(token string, keys []SortKey) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errors.New(ErrInvalidCursor)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, errors.New(ErrInvalidCursor)
+	}
+	if c.Sort != sortString(keys) || len(c.Values) != len(keys) {
+		return c, errors.New(ErrInvalidCursor)
+	}
+
+	for i, k := range keys {
+		v, ok := cursorValue(c.Values[i], k.kind)
+		if !ok {
+			return c, errors.New(ErrInvalidCursor)
+		}
+		c.Values[i] = v
+	}
+	return c, nil
+}
+
+func cursorValue(v interface{}, kind reflect.Kind) (interface{}, bool) {
+	switch kind {
+	case reflect.String:
+		s, ok := v.(string)
+		return s, ok
+	case reflect.Bool:
+		b, ok := v.(bool)
+		return b, ok
+	case reflect.Int:
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, false
+		}
+		return int(f), true
+	}
+	return nil, false
+}
+
+// ParseLimit reads a limit parameter. Without one the limit is def, larger
+// limits are capped to max. A max of zero means DefaultMaxPageSize.
+func ParseLimit(v string, def, max int64) (int64, error) {
+	if max <= 0 {
+		max = DefaultMaxPageSize
+	}
+	if v == "" {
+		return min(def, max), nil
+	}
+	limit, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, errors.New(ErrInvalidLimit)
+	}
+	return min(limit, max), nil
+}
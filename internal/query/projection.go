@@ -0,0 +1,54 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+)
+
+// Projection is the set of fields a response is limited to. Nil means every
+// field.
+type Projection []field
+
+// ParseProjection parses a comma separated list of field names like
+// "id,name,deviceTypeId". An empty list returns nil.
+func ParseProjection(v string) (Projection, error) {
+	var p Projection
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		f, err := lookupField(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[f.name] {
+			seen[f.name] = true
+			p = append(p, f)
+		}
+	}
+	return p, nil
+}
+
+// Keys returns the document keys of the projected fields, nil for all.
+func (p Projection) Keys() []string {
+	if p == nil {
+		return nil
+	}
+	keys := make([]string, len(p))
+	for i, f := range p {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// Select returns the projected fields of device by name.
+func (p Projection) Select(device model.Device) model.PartialDevice {
+	partial := make(model.PartialDevice, len(p))
+	for _, f := range p {
+		partial[f.name] = f.value(device)
+	}
+	return partial
+}
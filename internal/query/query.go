@@ -0,0 +1,153 @@
+// Package query turns the query parameters of list endpoints into filters
+// and options for the stores.
+package query
+
+import (
+	"net/url"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/database"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	ErrInvalidLimit      = "limit must be a positive number"
+	ErrInvalidCursor     = "cursor is invalid"
+	ErrUnknownField      = "unknown field"
+	ErrInvalidValue      = "invalid value"
+	ErrInvalidOperator   = "unsupported filter operator"
+	ErrRepeatedParameter = "parameter given more than once"
+	ErrRepeatedSortKey   = "sort key given more than once"
+	ErrAttributesPath    = "attributes can only be filtered by path"
+	ErrUnsortableField   = "field cannot be sorted"
+)
+
+// Reserved are the query parameters that are not filters.
+var Reserved = []string{"limit", "cursor", "sort", "q", "fields"}
+
+// Query is a parsed request for one page of the device list.
+type Query struct {
+	// Filter selects the devices, see ParseFilter and ParseExpr.
+	Filter bson.D
+	// Sort always ends with the id, see ParseSort.
+	Sort []SortKey
+	// Limit is the number of devices on the page.
+	Limit int64
+	// Cursor is where the page starts, nil for the first page.
+	Cursor *Cursor
+	// Fields limits the devices to some fields, nil for all.
+	Fields Projection
+}
+
+// Parse reads filters, the expression in q, sort, limit, cursor and fields
+// from the query parameters.
+func Parse(values url.Values, maxPageSize int64) (Query, error) {
+	var q Query
+	var err error
+	if q.Filter, err = ParseFilter(values, Reserved...); err != nil {
+		return q, err
+	}
+	if v := values.Get("q"); v != "" {
+		e, err := ParseExpr(v)
+		if err != nil {
+			return q, err
+		}
+		q.Filter = and(q.Filter, e.Filter())
+	}
+	if q.Sort, err = ParseSort(values.Get("sort")); err != nil {
+		return q, err
+	}
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultMaxPageSize
+	}
+	if q.Limit, err = ParseLimit(values.Get("limit"), maxPageSize, maxPageSize); err != nil {
+		return q, err
+	}
+	if v := values.Get("cursor"); v != "" {
+		c, err := DecodeCursor(v, q.Sort)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = &c
+	}
+	if q.Fields, err = ParseProjection(values.Get("fields")); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// All is a query for every device in id order, pageSize devices per page. A
+// pageSize of zero means DefaultMaxPageSize. Server side jobs page through
+// the whole collection with it.
+func All(pageSize int64) Query {
+	if pageSize <= 0 {
+		pageSize = DefaultMaxPageSize
+	}
+	return Query{Filter: bson.D{}, Sort: []SortKey{{field: fields["id"]}}, Limit: pageSize}
+}
+
+// FindFilter returns Filter restricted to the devices after the cursor.
+func (q Query) FindFilter() bson.D {
+	if q.Cursor == nil {
+		return q.Filter
+	}
+
+	// Keyset pagination: a device comes after the cursor if it equals the
+	// cursor on the first i keys and is past it on key i.
+	after := make(bson.A, len(q.Sort))
+	for i, k := range q.Sort {
+		clause := make(bson.D, 0, i+1)
+		for j, prev := range q.Sort[:i] {
+			clause = append(clause, bson.E{Key: prev.key, Value: bson.D{{Key: "$eq", Value: q.Cursor.Values[j]}}})
+		}
+		op := "$gt"
+		if k.Desc {
+			op = "$lt"
+		}
+		after[i] = append(clause, bson.E{Key: k.key, Value: bson.D{{Key: op, Value: q.Cursor.Values[i]}}})
+	}
+
+	return and(q.Filter, bson.D{{Key: "$or", Value: after}})
+}
+
+// and returns a filter matching both a and b.
+func and(a, b bson.D) bson.D {
+	if len(a) == 0 {
+		return b
+	}
+	return bson.D{{Key: "$and", Value: bson.A{a, b}}}
+}
+
+// FindOptions sorts the devices and fetches one more than the page holds, so
+// Next can tell whether another page follows. With Fields only those and the
+// sort keys, which the cursor needs, are fetched.
+func (q Query) FindOptions() database.FindOptions {
+	opts := database.FindOptions{
+		Sort:  sortDoc(q.Sort),
+		Limit: q.Limit + 1,
+	}
+	if q.Fields != nil {
+		opts.Projection = q.Fields.Keys()
+		for _, k := range q.Sort {
+			opts.Projection = append(opts.Projection, k.key)
+		}
+	}
+	return opts
+}
+
+// Next trims devices fetched with FindOptions to the page and returns the
+// cursor of the following page, nil on the last page.
+func (q Query) Next(devices []model.Device) ([]model.Device, *Cursor) {
+	if int64(len(devices)) <= q.Limit {
+		return devices, nil
+	}
+	devices = devices[:q.Limit]
+	last := devices[len(devices)-1]
+
+	c := &Cursor{Sort: sortString(q.Sort), Values: make([]interface{}, len(q.Sort))}
+	for i, k := range q.Sort {
+		c.Values[i] = k.value(last)
+	}
+	return devices, c
+}
@@ -0,0 +1,153 @@
+package query_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/query"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := query.ParseFilter(url.Values{
+		"failsafe":             {"true"},
+		"tempMax.gte":          {"60"},
+		"tempMax.lt":           {"80"},
+		"installationPosition": {"horizontal", "vertical"},
+		"limit":                {"10"},
+	}, query.Reserved...)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "failsafe", Value: bson.D{{Key: "$eq", Value: true}}},
+		{Key: "installationposition", Value: bson.D{{Key: "$in", Value: bson.A{"horizontal", "vertical"}}}},
+		{Key: "tempmax", Value: bson.D{{Key: "$gte", Value: 60}, {Key: "$lt", Value: 80}}},
+	}, filter)
+
+	// Values are never operators, even when they look like one.
+	filter, err = query.ParseFilter(url.Values{"name": {`{"$ne": ""}`}})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "name", Value: bson.D{{Key: "$eq", Value: `{"$ne": ""}`}}}}, filter)
+}
+
+func TestParseFilterAttributes(t *testing.T) {
+	filter, err := query.ParseFilter(url.Values{
+		"attributes.ports.gte":       {"8"},
+		"attributes.vendor.code":     {"SI"},
+		"attributes.poe":             {"true"},
+		"attributes.firmware":        {"2.1"},
+		"attributes.gt":              {"x"},
+		"attributes.vendor.code.lte": {"SZ"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "attributes.firmware", Value: bson.D{{Key: "$in", Value: bson.A{2.1, "2.1"}}}},
+		{Key: "attributes.gt", Value: bson.D{{Key: "$eq", Value: "x"}}},
+		{Key: "attributes.poe", Value: bson.D{{Key: "$in", Value: bson.A{true, "true"}}}},
+		{Key: "attributes.ports", Value: bson.D{{Key: "$gte", Value: 8}}},
+		{Key: "attributes.vendor.code", Value: bson.D{{Key: "$eq", Value: "SI"}, {Key: "$lte", Value: "SZ"}}},
+	}, filter)
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := map[string]url.Values{
+		`unknown field "color"`:                                                     {"color": {"red"}},
+		`unsupported filter operator "name.gte"`:                                    {"name.gte": {"a"}},
+		`unsupported filter operator "tempMax.regex"`:                               {"tempMax.regex": {"1"}},
+		`invalid value "yes please" for failsafe, expected true or false`:           {"failsafe": {"yes please"}},
+		`invalid value "hot" for tempMax, expected a number`:                        {"tempMax": {"hot"}},
+		`parameter given more than once "tempMin.gt"`:                               {"tempMin.gt": {"1", "2"}},
+		`attributes can only be filtered by path, use a path like attributes.ports`: {"attributes": {"1"}},
+		`unknown field "attributes..ports"`:                                         {"attributes..ports": {"1"}},
+		`unknown field "attributes.$where"`:                                         {"attributes.$where": {"1"}},
+	}
+	for want, values := range tests {
+		_, err := query.ParseFilter(values)
+		assert.EqualError(t, err, want)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	q, err := query.Parse(url.Values{"sort": {"-tempMax,name"}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "tempmax", Value: -1},
+		{Key: "name", Value: 1},
+		{Key: "_id", Value: 1},
+	}, q.FindOptions().Sort)
+
+	_, err = query.ParseSort("color")
+	assert.EqualError(t, err, `unknown field "color"`)
+	_, err = query.ParseSort("name,-name")
+	assert.EqualError(t, err, `sort key given more than once "name"`)
+	_, err = query.ParseSort("attributes")
+	assert.EqualError(t, err, `field cannot be sorted "attributes"`)
+}
+
+func TestParseLimit(t *testing.T) {
+	q, err := query.Parse(url.Values{}, 50)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), q.Limit)
+	assert.Nil(t, q.Cursor)
+
+	q, err = query.Parse(url.Values{"limit": {"500"}}, 50)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), q.Limit, "limit should be capped to the max page size")
+
+	q, err = query.Parse(url.Values{"limit": {"2"}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), q.Limit)
+
+	for _, limit := range []string{"0", "-1", "ten"} {
+		_, err := query.Parse(url.Values{"limit": {limit}}, 50)
+		assert.EqualError(t, err, query.ErrInvalidLimit, limit)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	q, err := query.Parse(url.Values{"sort": {"-tempMax"}, "limit": {"2"}}, 0)
+	assert.Nil(t, err)
+
+	devices := []model.Device{{ID: "a", TempMax: 70}, {ID: "b", TempMax: 60}, {ID: "c", TempMax: 60}}
+	page, next := q.Next(devices)
+	assert.Len(t, page, 2)
+	assert.NotNil(t, next)
+
+	_, last := q.Next(devices[:2])
+	assert.Nil(t, last)
+
+	q, err = query.Parse(url.Values{"sort": {"-tempMax"}, "cursor": {next.Encode()}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "tempmax", Value: bson.D{{Key: "$lt", Value: 60}}}},
+		bson.D{
+			{Key: "tempmax", Value: bson.D{{Key: "$eq", Value: 60}}},
+			{Key: "_id", Value: bson.D{{Key: "$gt", Value: "b"}}},
+		},
+	}}}, q.FindFilter())
+
+	// A cursor only works with the sort order it was created for.
+	_, err = query.Parse(url.Values{"cursor": {next.Encode()}}, 0)
+	assert.EqualError(t, err, query.ErrInvalidCursor)
+
+	for _, token := range []string{"not base64!", "e30"} {
+		_, err := query.Parse(url.Values{"cursor": {token}}, 0)
+		assert.EqualError(t, err, query.ErrInvalidCursor, token)
+	}
+}
+
+func TestParseProjection(t *testing.T) {
+	q, err := query.Parse(url.Values{"fields": {"id, name,deviceTypeId,name"}, "sort": {"-tempMax"}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_id", "name", "devicetypeid", "tempmax", "_id"}, q.FindOptions().Projection)
+	assert.Equal(t, model.PartialDevice{"id": "a", "name": "S7-1500", "deviceTypeId": "CPU"},
+		q.Fields.Select(model.Device{ID: "a", Name: "S7-1500", DeviceTypeID: "CPU", TempMax: 70}))
+
+	q, err = query.Parse(url.Values{}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, q.FindOptions().Projection)
+
+	_, err = query.ParseProjection("id,color")
+	assert.EqualError(t, err, `unknown field "color"`)
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SortKey is one key of a sort order.
+type SortKey struct {
+	field
+	Desc bool
+}
+
+// ParseSort parses a comma separated list of field names, each optionally
+// prefixed with - for descending order, like "-tempMax,name". The id is
+// appended as last key when missing so the order is total and can be paged.
+func ParseSort(v string) ([]SortKey, error) {
+	var keys []SortKey
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		desc := strings.HasPrefix(name, "-")
+		f, err := lookupField(strings.TrimPrefix(name, "-"))
+		if err != nil {
+			return nil, err
+		}
+		if f.kind == reflect.Map {
+			return nil, fmt.Errorf("%s %q", ErrUnsortableField, f.name)
+		}
+		if seen[f.name] {
+			return nil, fmt.Errorf("%s %q", ErrRepeatedSortKey, f.name)
+		}
+		seen[f.name] = true
+		keys = append(keys, SortKey{field: f, Desc: desc})
+	}
+	if !seen["id"] {
+		keys = append(keys, SortKey{field: fields["id"]})
+	}
+	return keys, nil
+}
+
+// sortString returns the keys in the form ParseSort reads.
+func sortString(keys []SortKey) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.name
+		if k.Desc {
+			names[i] = "-" + k.name
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func sortDoc(keys []SortKey) bson.D {
+	doc := make(bson.D, len(keys))
+	for i, k := range keys {
+		direction := 1
+		if k.Desc {
+			direction = -1
+		}
+		doc[i] = bson.E{Key: k.key, Value: direction}
+	}
+	return doc
+}
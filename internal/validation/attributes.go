@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaURL names an attributesSchema while it is compiled.
+const schemaURL = "urn:attributes"
+
+// CompileSchema compiles the attributesSchema of a device type. A schema may
+// only refer to itself, references to files or URLs are an error.
+func CompileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("%q cannot be loaded, attributesSchema must be self-contained", s)
+	}
+	if err := c.AddResource(schemaURL, bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	compiled, err := c.Compile(schemaURL)
+	// The cause is enough, the schema URL only names it internally.
+	var schemaErr *jsonschema.SchemaError
+	if errors.As(err, &schemaErr) && schemaErr.Err != nil {
+		return nil, schemaErr.Err
+	}
+	return compiled, err
+}
+
+// Attributes returns every violation of schema by attributes. Fields are
+// paths like attributes.vendor.code and rules are the schema keywords that
+// failed, like minimum or required. Nil attributes are an empty object.
+func Attributes(schema *jsonschema.Schema, attributes map[string]interface{}) []Violation {
+	v := validator{}
+
+	// Values read from a store can have types like int32 that the schema
+	// validator does not know, JSON turns them into plain ones.
+	var doc interface{} = map[string]interface{}{}
+	if attributes != nil {
+		raw, err := json.Marshal(attributes)
+		if err == nil {
+			err = json.Unmarshal(raw, &doc)
+		}
+		if err != nil {
+			v.add("attributes", RuleType, "attributes must be a JSON object")
+			return v.violations
+		}
+	}
+
+	err := schema.Validate(doc)
+	var invalid *jsonschema.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		v.schemaErrors(invalid)
+	case err != nil:
+		v.add("attributes", RuleFormat, err.Error())
+	}
+	return v.violations
+}
+
+// schemaErrors adds the innermost errors of e, they name the actual keyword
+// and value that failed.
+func (v *validator) schemaErrors(e *jsonschema.ValidationError) {
+	if len(e.Causes) > 0 {
+		for _, cause := range e.Causes {
+			v.schemaErrors(cause)
+		}
+		return
+	}
+
+	field := "attributes"
+	for _, part := range strings.Split(e.InstanceLocation, "/")[1:] {
+		field += "." + strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+	}
+	rule := e.KeywordLocation[strings.LastIndex(e.KeywordLocation, "/")+1:]
+	v.add(field, rule, fmt.Sprintf("%s: %s", field, e.Message))
+}
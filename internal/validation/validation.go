@@ -0,0 +1,379 @@
+// Package validation checks devices against the configured rules before they
+// are stored.
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Rules reported in violations.
+const (
+	RuleRequired = "required"
+	RuleFormat   = "format"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RuleOneOf    = "oneOf"
+	RuleOrder    = "lessOrEqual"
+	RuleExists   = "exists"
+	RuleType     = "type"
+	RuleUnique   = "unique"
+	RuleFits     = "fits"
+)
+
+// Violation is a field of a device that breaks a rule.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Range is an inclusive range of numbers.
+type Range struct {
+	Min int
+	Max int
+}
+
+// Rules are the configurable limits of a device. A nil range stands for the
+// default range of its rule.
+type Rules struct {
+	// InstallationPositions are the allowed values of installationPosition.
+	// An empty installationPosition is always allowed.
+	InstallationPositions []string
+	// Temperature limits tempMin and tempMax, in °C.
+	Temperature *Range
+	// AxisNumber limits rotationAxisNumber and positionAxisNumber.
+	AxisNumber *Range
+	// RequiredAxes limits rotationAxes and positionAxes of a motion
+	// requirement.
+	RequiredAxes *Range
+	// Quantity limits the quantity of a device of a motion requirement.
+	Quantity *Range
+	// SlotCount limits slotCount of a rack.
+	SlotCount *Range
+}
+
+// DefaultRules are used for every rule that is not configured.
+func DefaultRules() Rules {
+	return Rules{
+		InstallationPositions: []string{"horizontal", "vertical"},
+		Temperature:           &Range{Min: -40, Max: 85},
+		AxisNumber:            &Range{Min: 0, Max: 64},
+		RequiredAxes:          &Range{Min: 0, Max: 256},
+		Quantity:              &Range{Min: 1, Max: 1000},
+		SlotCount:             &Range{Min: 1, Max: 64},
+	}
+}
+
+// WithDefaults fills every rule that is not configured with its default.
+func (r Rules) WithDefaults() Rules {
+	d := DefaultRules()
+	if len(r.InstallationPositions) == 0 {
+		r.InstallationPositions = d.InstallationPositions
+	}
+	if r.Temperature == nil {
+		r.Temperature = d.Temperature
+	}
+	if r.AxisNumber == nil {
+		r.AxisNumber = d.AxisNumber
+	}
+	if r.RequiredAxes == nil {
+		r.RequiredAxes = d.RequiredAxes
+	}
+	if r.Quantity == nil {
+		r.Quantity = d.Quantity
+	}
+	if r.SlotCount == nil {
+		r.SlotCount = d.SlotCount
+	}
+	return r
+}
+
+// idPattern keeps ids usable as a path segment without escaping.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,64}$`)
+
+// Device returns every violation of the rules by device. sent holds the JSON
+// fields that were given, only those are checked and rules comparing two
+// fields need both. Nil sent checks the whole device.
+func (r Rules) Device(device model.Device, sent []string) []Violation {
+	r = r.WithDefaults()
+	v := validator{sent: sent}
+
+	switch {
+	case device.ID != "" && !idPattern.MatchString(device.ID):
+		v.add("id", RuleFormat, "id may only contain up to 64 letters, digits and . _ ~ -")
+	case device.ID == "" && containsFold(sent, "id"):
+		v.add("id", RuleRequired, "id must not be empty, leave it out to generate one")
+	}
+	if v.has("name") && strings.TrimSpace(device.Name) == "" {
+		v.add("name", RuleRequired, "name must not be empty")
+	}
+
+	v.inRange("tempMin", device.TempMin, *r.Temperature)
+	v.inRange("tempMax", device.TempMax, *r.Temperature)
+	if v.has("tempMin") && v.has("tempMax") && device.TempMin > device.TempMax {
+		v.add("tempMin", RuleOrder, "tempMin must not be greater than tempMax")
+	}
+	v.inRange("rotationAxisNumber", device.RotationAxisNumber, *r.AxisNumber)
+	v.inRange("positionAxisNumber", device.PositionAxisNumber, *r.AxisNumber)
+
+	if v.has("installationPosition") && device.InstallationPosition != "" &&
+		!contains(r.InstallationPositions, device.InstallationPosition) {
+		v.add("installationPosition", RuleOneOf,
+			fmt.Sprintf("installationPosition must be one of %s", strings.Join(r.InstallationPositions, ", ")))
+	}
+	return v.violations
+}
+
+// Devices validates a batch. Fields are prefixed with the index of their
+// device, like devices[2].tempMin. sent is indexed like devices and may be
+// nil.
+func (r Rules) Devices(devices []model.Device, sent [][]string) []Violation {
+	var violations []Violation
+	for i, device := range devices {
+		var fields []string
+		if i < len(sent) {
+			fields = sent[i]
+		}
+		for _, v := range r.Device(device, fields) {
+			v.Field = fmt.Sprintf("devices[%d].%s", i, v.Field)
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// DeviceType returns every violation of the rules by t. Its defaults have to
+// be device fields other than id and deviceTypeId with values that pass the
+// device rules, and its attributesSchema has to compile. Default attributes
+// have to match the schema.
+func (r Rules) DeviceType(t model.DeviceType) []Violation {
+	v := validator{}
+	if !idPattern.MatchString(t.ID) {
+		v.add("id", RuleFormat, "id must be 1 to 64 letters, digits and . _ ~ -")
+	}
+	if strings.TrimSpace(t.Name) == "" {
+		v.add("name", RuleRequired, "name must not be empty")
+	}
+	var schema *jsonschema.Schema
+	if len(t.AttributesSchema) > 0 {
+		var err error
+		if schema, err = CompileSchema(t.AttributesSchema); err != nil {
+			v.add("attributesSchema", RuleFormat, fmt.Sprintf("attributesSchema is not a valid JSON Schema: %s", err))
+		}
+	}
+
+	keys := make([]string, 0, len(t.Defaults))
+	for key := range t.Defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var device model.Device
+	var sent []string
+	for _, key := range keys {
+		field := "defaults." + key
+		if !containsFold(deviceFields, key) || strings.EqualFold(key, "id") || strings.EqualFold(key, "deviceTypeId") {
+			v.add(field, RuleOneOf, fmt.Sprintf("%s is not a device field that can have a default", field))
+			continue
+		}
+		raw, err := json.Marshal(map[string]interface{}{key: t.Defaults[key]})
+		if err == nil {
+			err = json.Unmarshal(raw, &device)
+		}
+		if err != nil {
+			v.add(field, RuleType, fmt.Sprintf("%s has the wrong type", field))
+			continue
+		}
+		sent = append(sent, key)
+	}
+	if len(sent) > 0 {
+		for _, violation := range r.Device(device, sent) {
+			v.add("defaults."+violation.Field, violation.Rule, violation.Message)
+		}
+	}
+	if schema != nil && containsFold(sent, "attributes") {
+		for _, violation := range Attributes(schema, device.Attributes) {
+			v.add("defaults."+violation.Field, violation.Rule, violation.Message)
+		}
+	}
+	return v.violations
+}
+
+// Environment returns every violation of the rules by a planning request.
+// Both ambient temperatures are required and its installation position has
+// to be one the rules allow.
+func (r Rules) Environment(env model.Environment) []Violation {
+	r = r.WithDefaults()
+	v := validator{}
+	if env.AmbientMin == nil {
+		v.add("ambientMin", RuleRequired, "ambientMin is required")
+	}
+	if env.AmbientMax == nil {
+		v.add("ambientMax", RuleRequired, "ambientMax is required")
+	}
+	if env.AmbientMin != nil && env.AmbientMax != nil && *env.AmbientMin > *env.AmbientMax {
+		v.add("ambientMin", RuleOrder, "ambientMin must not be greater than ambientMax")
+	}
+	if env.InstallationPosition != "" && !contains(r.InstallationPositions, env.InstallationPosition) {
+		v.add("installationPosition", RuleOneOf,
+			fmt.Sprintf("installationPosition must be one of %s", strings.Join(r.InstallationPositions, ", ")))
+	}
+	if env.Limit < 0 {
+		v.add("limit", RuleMin, "limit must be at least 1")
+	}
+	return v.violations
+}
+
+// Motion returns every violation of the rules by a motion requirement.
+// Every line needs a device id and a quantity within the rules, fields of
+// lines are prefixed like devices[2].quantity.
+func (r Rules) Motion(req model.MotionRequirement) []Violation {
+	r = r.WithDefaults()
+	v := validator{}
+	for i, line := range req.Devices {
+		field := fmt.Sprintf("devices[%d]", i)
+		if line.DeviceID == "" {
+			v.add(field+".deviceId", RuleRequired, field+".deviceId must not be empty")
+		}
+		v.inRange(field+".quantity", line.Quantity, *r.Quantity)
+	}
+	v.inRange("rotationAxes", req.RotationAxes, *r.RequiredAxes)
+	v.inRange("positionAxes", req.PositionAxes, *r.RequiredAxes)
+	return v.violations
+}
+
+// Project returns every violation of the rules by p and its cabinets, see
+// Cabinet. Fields of cabinets are prefixed like cabinets[1].name.
+func (r Rules) Project(p model.Project) []Violation {
+	v := validator{}
+	v.id(p.ID)
+	if strings.TrimSpace(p.Name) == "" {
+		v.add("name", RuleRequired, "name must not be empty")
+	}
+	seen := make(map[string]bool)
+	for i, c := range p.Cabinets {
+		prefix := fmt.Sprintf("cabinets[%d]", i)
+		if seen[c.ID] {
+			v.add(prefix+".id", RuleUnique, fmt.Sprintf("cabinet %q is declared twice", c.ID))
+		}
+		seen[c.ID] = true
+		v.nested(prefix, r.Cabinet(c))
+	}
+	return v.violations
+}
+
+// Cabinet returns every violation of the rules by c and its racks, see Rack.
+// Fields of racks are prefixed like racks[0].slotCount.
+func (r Rules) Cabinet(c model.Cabinet) []Violation {
+	v := validator{}
+	v.id(c.ID)
+	seen := make(map[string]bool)
+	for i, rack := range c.Racks {
+		prefix := fmt.Sprintf("racks[%d]", i)
+		if seen[rack.ID] {
+			v.add(prefix+".id", RuleUnique, fmt.Sprintf("rack %q is declared twice", rack.ID))
+		}
+		seen[rack.ID] = true
+		v.nested(prefix, r.Rack(rack))
+	}
+	return v.violations
+}
+
+// Rack returns every violation of the rules by rack. Every slot needs a
+// device and a number between 1 and slotCount that no other slot has. The
+// devices themselves are not checked.
+func (r Rules) Rack(rack model.Rack) []Violation {
+	r = r.WithDefaults()
+	v := validator{}
+	v.id(rack.ID)
+	v.inRange("slotCount", rack.SlotCount, *r.SlotCount)
+	seen := make(map[int]bool)
+	for i, slot := range rack.Slots {
+		prefix := fmt.Sprintf("slots[%d]", i)
+		switch {
+		case slot.Number < 1 || slot.Number > rack.SlotCount:
+			v.add(prefix+".number", RuleOneOf, fmt.Sprintf("%s.number must be between 1 and %d", prefix, rack.SlotCount))
+		case seen[slot.Number]:
+			v.add(prefix+".number", RuleUnique, fmt.Sprintf("slot %d is taken twice", slot.Number))
+		}
+		seen[slot.Number] = true
+		if slot.DeviceID == "" {
+			v.add(prefix+".deviceId", RuleRequired, prefix+".deviceId must not be empty")
+		}
+	}
+	return v.violations
+}
+
+// deviceFields are the JSON names of model.Device.
+var deviceFields = func() []string {
+	t := reflect.TypeOf(model.Device{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return names
+}()
+
+type validator struct {
+	sent       []string
+	violations []Violation
+}
+
+func (v *validator) has(field string) bool {
+	return v.sent == nil || containsFold(v.sent, field)
+}
+
+func (v *validator) add(field, rule, msg string) {
+	v.violations = append(v.violations, Violation{Field: field, Rule: rule, Message: msg})
+}
+
+// id checks the id of a project, cabinet or rack.
+func (v *validator) id(id string) {
+	if !idPattern.MatchString(id) {
+		v.add("id", RuleFormat, "id must be 1 to 64 letters, digits and . _ ~ -")
+	}
+}
+
+// nested adds violations of a part, with their fields below prefix.
+func (v *validator) nested(prefix string, violations []Violation) {
+	for _, violation := range violations {
+		v.add(prefix+"."+violation.Field, violation.Rule, violation.Message)
+	}
+}
+
+func (v *validator) inRange(field string, n int, r Range) {
+	switch {
+	case !v.has(field):
+	case n < r.Min:
+		v.add(field, RuleMin, fmt.Sprintf("%s must be at least %d", field, r.Min))
+	case n > r.Max:
+		v.add(field, RuleMax, fmt.Sprintf("%s must be at most %d", field, r.Max))
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package validation_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DerRomtester/testproject-golang-webapi-1/internal/validation"
+	"github.com/DerRomtester/testproject-golang-webapi-1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(violations []validation.Violation) map[string]string {
+	m := make(map[string]string, len(violations))
+	for _, v := range violations {
+		m[v.Field] = v.Rule
+	}
+	return m
+}
+
+func TestDeviceValid(t *testing.T) {
+	device := model.Device{ID: "a", Name: "S7-1500", TempMin: -25, TempMax: 70, InstallationPosition: "horizontal"}
+	assert.Empty(t, validation.Rules{}.Device(device, nil))
+}
+
+func TestDeviceReportsEveryViolation(t *testing.T) {
+	device := model.Device{
+		ID:                   "a b",
+		TempMin:              60,
+		TempMax:              90,
+		RotationAxisNumber:   -1,
+		InstallationPosition: "upside down",
+	}
+	assert.Equal(t, map[string]string{
+		"id":                   validation.RuleFormat,
+		"name":                 validation.RuleRequired,
+		"tempMax":              validation.RuleMax,
+		"rotationAxisNumber":   validation.RuleMin,
+		"installationPosition": validation.RuleOneOf,
+	}, rules(validation.Rules{}.Device(device, nil)))
+
+	device = model.Device{Name: "S7-1500", TempMin: 60, TempMax: 50}
+	assert.Equal(t, map[string]string{"tempMin": validation.RuleOrder}, rules(validation.Rules{}.Device(device, nil)))
+}
+
+func TestDeviceOnlyChecksSentFields(t *testing.T) {
+	// A merge of tempMin alone cannot be compared with the stored tempMax.
+	device := model.Device{ID: "a", TempMin: 10}
+	assert.Empty(t, validation.Rules{}.Device(device, []string{"ID", "tempMin"}))
+
+	device = model.Device{}
+	assert.Equal(t, map[string]string{"id": validation.RuleRequired, "name": validation.RuleRequired},
+		rules(validation.Rules{}.Device(device, []string{"ID", "name"})))
+}
+
+func TestConfiguredRules(t *testing.T) {
+	r := validation.Rules{InstallationPositions: []string{"wall"}, Temperature: &validation.Range{Min: 0, Max: 40}}
+	device := model.Device{Name: "S7-1500", TempMin: -10, TempMax: 30, InstallationPosition: "horizontal"}
+	assert.Equal(t, map[string]string{
+		"tempMin":              validation.RuleMin,
+		"installationPosition": validation.RuleOneOf,
+	}, rules(r.Device(device, nil)))
+	assert.Equal(t, validation.DefaultRules().AxisNumber, r.WithDefaults().AxisNumber)
+
+	// A configured zero range is kept and not replaced by the default.
+	r = validation.Rules{AxisNumber: &validation.Range{}}
+	device = model.Device{Name: "S7-1500", RotationAxisNumber: 1}
+	assert.Equal(t, map[string]string{"rotationAxisNumber": validation.RuleMax}, rules(r.Device(device, nil)))
+}
+
+func TestDevicesPrefixesIndex(t *testing.T) {
+	violations := validation.Rules{}.Devices([]model.Device{{Name: "ok"}, {TempMax: 100}}, [][]string{nil, {"tempMax"}})
+	assert.Equal(t, []validation.Violation{{Field: "devices[1].tempMax", Rule: validation.RuleMax, Message: "tempMax must be at most 85"}}, violations)
+}
+
+func TestDeviceType(t *testing.T) {
+	valid := model.DeviceType{ID: "cpu", Name: "CPU", Defaults: map[string]interface{}{"failsafe": true, "tempMax": 60.0}}
+	assert.Empty(t, validation.Rules{}.DeviceType(valid))
+
+	invalid := model.DeviceType{ID: "c p u", Defaults: map[string]interface{}{
+		"color":        "red",
+		"deviceTypeId": "io",
+		"failsafe":     "yes",
+		"tempMax":      200,
+	}}
+	assert.Equal(t, map[string]string{
+		"id":                    validation.RuleFormat,
+		"name":                  validation.RuleRequired,
+		"defaults.color":        validation.RuleOneOf,
+		"defaults.deviceTypeId": validation.RuleOneOf,
+		"defaults.failsafe":     validation.RuleType,
+		"defaults.tempMax":      validation.RuleMax,
+	}, rules(validation.Rules{}.DeviceType(invalid)))
+}
+
+func TestAttributes(t *testing.T) {
+	schema, err := validation.CompileSchema([]byte(`{
+		"type": "object",
+		"required": ["ports"],
+		"properties": {
+			"ports": {"type": "integer", "minimum": 1},
+			"vendor": {"type": "object", "properties": {"code": {"enum": ["SI", "SZ"]}}}
+		},
+		"additionalProperties": false
+	}`))
+	assert.Nil(t, err)
+
+	assert.Empty(t, validation.Attributes(schema, map[string]interface{}{"ports": 8.0, "vendor": map[string]interface{}{"code": "SI"}}))
+	assert.Equal(t, map[string]string{"attributes": "required"}, rules(validation.Attributes(schema, nil)))
+	assert.Equal(t, map[string]string{
+		"attributes.ports":       "minimum",
+		"attributes.vendor.code": "enum",
+		"attributes":             "additionalProperties",
+	}, rules(validation.Attributes(schema, map[string]interface{}{
+		"ports":  int32(0),
+		"vendor": map[string]interface{}{"code": "XX"},
+		"color":  "red",
+	})))
+}
+
+func TestDeviceTypeSchema(t *testing.T) {
+	valid := model.DeviceType{ID: "switch", Name: "Switch",
+		AttributesSchema: []byte(`{"properties": {"ports": {"type": "integer"}}}`),
+		Defaults:         map[string]interface{}{"attributes": map[string]interface{}{"ports": 8}},
+	}
+	assert.Empty(t, validation.Rules{}.DeviceType(valid))
+
+	invalid := model.DeviceType{ID: "switch", Name: "Switch",
+		AttributesSchema: []byte(`{"properties": {"ports": {"type": "integer"}}}`),
+		Defaults:         map[string]interface{}{"attributes": map[string]interface{}{"ports": "eight"}},
+	}
+	assert.Equal(t, map[string]string{"defaults.attributes.ports": "type"}, rules(validation.Rules{}.DeviceType(invalid)))
+
+	for _, schema := range []string{`{"type": "ports"}`, `{"$ref": "file:///etc/passwd"}`, `{"type": `} {
+		typ := model.DeviceType{ID: "switch", Name: "Switch", AttributesSchema: []byte(schema)}
+		assert.Equal(t, map[string]string{"attributesSchema": validation.RuleFormat}, rules(validation.Rules{}.DeviceType(typ)), schema)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	lo, hi := 50, -10
+	assert.Equal(t, map[string]string{
+		"ambientMax": validation.RuleRequired,
+		"limit":      validation.RuleMin,
+	}, rules(validation.Rules{}.Environment(model.Environment{AmbientMin: &lo, Limit: -1})))
+	assert.Equal(t, map[string]string{
+		"ambientMin":           validation.RuleOrder,
+		"installationPosition": validation.RuleOneOf,
+	}, rules(validation.Rules{}.Environment(model.Environment{AmbientMin: &lo, AmbientMax: &hi, InstallationPosition: "upside down"})))
+}
+
+func TestMotion(t *testing.T) {
+	assert.Empty(t, validation.Rules{}.Motion(model.MotionRequirement{
+		Devices: []model.MotionLine{{DeviceID: "a", Quantity: 2}}, RotationAxes: 4,
+	}))
+	assert.Equal(t, map[string]string{
+		"devices[0].quantity": validation.RuleMin,
+		"devices[1].deviceId": validation.RuleRequired,
+		"devices[2].quantity": validation.RuleMax,
+		"rotationAxes":        validation.RuleMin,
+		"positionAxes":        validation.RuleMax,
+	}, rules(validation.Rules{}.Motion(model.MotionRequirement{
+		Devices:      []model.MotionLine{{DeviceID: "a"}, {Quantity: 1}, {DeviceID: "b", Quantity: math.MaxInt}},
+		RotationAxes: -1,
+		PositionAxes: 257,
+	})))
+}
+
+func TestProject(t *testing.T) {
+	rack := model.Rack{ID: "r1", SlotCount: 4, Slots: []model.Slot{{Number: 1, DeviceID: "a"}, {Number: 4, DeviceID: "b"}}}
+	assert.Empty(t, validation.Rules{}.Project(model.Project{ID: "p", Name: "Line 1", Cabinets: []model.Cabinet{
+		{ID: "c1", Racks: []model.Rack{rack}},
+	}}))
+
+	assert.Equal(t, map[string]string{
+		"name":                                   validation.RuleRequired,
+		"cabinets[1].id":                         validation.RuleUnique,
+		"cabinets[1].racks[0].slotCount":         validation.RuleMin,
+		"cabinets[1].racks[0].slots[0].number":   validation.RuleOneOf,
+		"cabinets[1].racks[1].id":                validation.RuleUnique,
+		"cabinets[1].racks[1].slots[1].number":   validation.RuleUnique,
+		"cabinets[1].racks[1].slots[2].deviceId": validation.RuleRequired,
+		"cabinets[1].racks[1].slots[2].number":   validation.RuleOneOf,
+	}, rules(validation.Rules{}.Project(model.Project{ID: "p", Cabinets: []model.Cabinet{
+		{ID: "c1"},
+		{ID: "c1", Racks: []model.Rack{
+			{ID: "r1", Slots: []model.Slot{{Number: 1, DeviceID: "a"}}},
+			{ID: "r1", SlotCount: 4, Slots: []model.Slot{{Number: 2, DeviceID: "a"}, {Number: 2, DeviceID: "b"}, {Number: 5}}},
+		}},
+	}})))
+}
@@ -4,8 +4,47 @@ type Devices struct {
 	Devices []Device `json:"devices"`
 }
 
+// DevicePage is one page of a device list. Next is the cursor of the
+// following page and empty on the last one.
+type DevicePage struct {
+	Devices []Device `json:"devices"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// PartialDevice holds the fields of a device that were asked for with the
+// fields parameter, by their JSON name.
+type PartialDevice map[string]interface{}
+
+// PartialDevicePage is a DevicePage limited to some fields.
+type PartialDevicePage struct {
+	Devices []PartialDevice `json:"devices"`
+	Next    string          `json:"next,omitempty"`
+}
+
+// DeviceBatchGet is the body of POST /v1/devices:batchGet.
+type DeviceBatchGet struct {
+	IDs []string `json:"ids"`
+}
+
+// DeviceBatch holds the devices of a batch get in the order of the requested
+// ids and the ids that have no device.
+type DeviceBatch struct {
+	Devices []Device `json:"devices"`
+	Missing []string `json:"missing"`
+}
+
+// DeviceSearch is the body of POST /v1/devices/search. Query is an
+// expression like in the q parameter of GET /v1/devices.
+type DeviceSearch struct {
+	Query  string `json:"q"`
+	Sort   string `json:"sort,omitempty"`
+	Limit  int64  `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Fields string `json:"fields,omitempty"`
+}
+
 type Device struct {
-	ID                              string `bson:"_id,omitempty"`
+	ID                              string `bson:"_id,omitempty" json:"id"`
 	Name                            string `json:"name"`
 	DeviceTypeID                    string `json:"deviceTypeId"`
 	Failsafe                        bool   `json:"failsafe"`
@@ -20,4 +59,55 @@ type Device struct {
 	PositionAxisNumber              int    `json:"positionAxisNumber"`
 	AdvancedEnvironmentalConditions bool   `json:"advancedEnvironmentalConditions,omitempty"`
 	TerminalElement                 bool   `json:"terminalElement,omitempty"`
+	// Attributes are custom values checked against the attributesSchema of
+	// the device type, for example {"ports": 8, "vendor": {"code": "SI"}}.
+	Attributes map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+}
+
+// Outcome of writing a single device.
+const (
+	WriteCreated   = "created"
+	WriteUpdated   = "updated"
+	WriteUnchanged = "unchanged"
+	WriteFailed    = "failed"
+	WriteConflict  = "conflict"
+)
+
+// How an incoming device is combined with an already stored one.
+const (
+	// WriteModeMerge overwrites the fields that were sent and keeps the rest.
+	WriteModeMerge = "merge"
+	// WriteModeReplace stores the device exactly as sent.
+	WriteModeReplace = "replace"
+	// WriteModeCreate only stores new devices, existing ones are a conflict.
+	WriteModeCreate = "create"
+)
+
+type DeviceWriteResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+	Reason string `json:"reason,omitempty"`
+	// Warnings are the catalog rules with severity warning that the device
+	// breaks. They do not keep it from being written.
+	Warnings []RuleFinding `json:"warnings,omitempty"`
+}
+
+type DeviceWriteResults struct {
+	Results []DeviceWriteResult `json:"results"`
+}
+
+// DeviceMatch is a device found by a text search. Higher scores are better
+// matches, the scale depends on the storage backend.
+type DeviceMatch struct {
+	Device Device  `json:"device"`
+	Score  float64 `json:"score"`
+}
+
+type DeviceMatches struct {
+	Matches []DeviceMatch `json:"matches"`
+}
+
+type DeviceSuggestions struct {
+	Suggestions []string `json:"suggestions"`
 }
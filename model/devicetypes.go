@@ -0,0 +1,20 @@
+package model
+
+import "encoding/json"
+
+// DeviceType groups devices of one kind, Device.DeviceTypeID refers to its ID.
+type DeviceType struct {
+	ID          string `bson:"_id" json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Defaults are device fields by JSON name that devices of the type
+	// usually have, for example {"failsafe": true, "tempMax": 60}.
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	// AttributesSchema is a JSON Schema the attributes of devices of the
+	// type must match. Without one any attributes are accepted.
+	AttributesSchema json.RawMessage `json:"attributesSchema,omitempty" bson:"attributesschema,omitempty"`
+}
+
+type DeviceTypes struct {
+	DeviceTypes []DeviceType `json:"deviceTypes"`
+}
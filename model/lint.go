@@ -0,0 +1,31 @@
+package model
+
+// Severities of catalog rules. Errors reject a write, warnings are only
+// reported.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// RuleFinding is a catalog rule that a device breaks.
+type RuleFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// DeviceLint lists the catalog rules one device breaks.
+type DeviceLint struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Findings []RuleFinding `json:"findings"`
+}
+
+// LintReport is the result of GET /v1/devices/lint. Devices only holds the
+// devices with findings.
+type LintReport struct {
+	Checked  int          `json:"checked"`
+	Errors   int          `json:"errors"`
+	Warnings int          `json:"warnings"`
+	Devices  []DeviceLint `json:"devices"`
+}
@@ -0,0 +1,106 @@
+package model
+
+// Environment is the body of POST /v1/planning/environment. It describes an
+// enclosure: the ambient temperatures in °C it sees, how devices are mounted
+// in it and whether it is a 19 inch cabinet. DeviceIDs optionally selects
+// devices whose combined operating envelope should be computed.
+type Environment struct {
+	AmbientMin              *int     `json:"ambientMin"`
+	AmbientMax              *int     `json:"ambientMax"`
+	InstallationPosition    string   `json:"installationPosition,omitempty"`
+	InsertInto19InchCabinet bool     `json:"insertInto19InchCabinet"`
+	DeviceIDs               []string `json:"deviceIds,omitempty"`
+	Limit                   int64    `json:"limit,omitempty"`
+}
+
+// Kinds of envelope conflicts, named after the device field they concern.
+const (
+	ConflictTemperature          = "temperature"
+	ConflictInstallationPosition = "installationPosition"
+	ConflictCabinet              = "insertInto19InchCabinet"
+)
+
+// EnvelopeConflict is a reason why some of the selected devices cannot run
+// together in the environment.
+type EnvelopeConflict struct {
+	Kind    string   `json:"kind"`
+	Devices []string `json:"devices"`
+	Message string   `json:"message"`
+}
+
+// OperatingEnvelope is what a set of devices tolerates together.
+type OperatingEnvelope struct {
+	Devices []string `json:"devices"`
+	Missing []string `json:"missing"`
+	// TempMin and TempMax are the intersection of the temperature ranges,
+	// both are left out when the ranges do not overlap.
+	TempMin *int `json:"tempMin,omitempty"`
+	TempMax *int `json:"tempMax,omitempty"`
+	// InstallationPosition is the position all devices can be mounted in,
+	// empty when they accept any position or need different ones.
+	InstallationPosition string `json:"installationPosition,omitempty"`
+	// InsertInto19InchCabinet reports whether every device fits a 19 inch
+	// cabinet.
+	InsertInto19InchCabinet bool `json:"insertInto19InchCabinet"`
+	// Suitable is true when there are no conflicts.
+	Suitable  bool               `json:"suitable"`
+	Conflicts []EnvelopeConflict `json:"conflicts"`
+}
+
+// EnvironmentPlan is the result of POST /v1/planning/environment. Devices
+// are the devices that can run in the environment, ordered by id.
+type EnvironmentPlan struct {
+	Devices  []Device           `json:"devices"`
+	Envelope *OperatingEnvelope `json:"envelope,omitempty"`
+}
+
+// MotionLine is a quantity of one device in a motion requirement.
+type MotionLine struct {
+	DeviceID string `json:"deviceId"`
+	Quantity int    `json:"quantity"`
+}
+
+// MotionRequirement is the body of POST /v1/planning/motion. It selects
+// devices with quantities and states how many rotary and positioning axes a
+// project needs.
+type MotionRequirement struct {
+	Devices      []MotionLine `json:"devices"`
+	RotationAxes int          `json:"rotationAxes"`
+	PositionAxes int          `json:"positionAxes"`
+}
+
+// AxisBalance compares the axes of one kind that a selection provides with
+// the required ones.
+type AxisBalance struct {
+	Required  int `json:"required"`
+	Available int `json:"available"`
+	// Margin is Available minus Required, negative when axes are missing.
+	Margin int `json:"margin"`
+}
+
+// MotionSuggestion is a device to add to a selection. The axes are those of
+// all Quantity devices together.
+type MotionSuggestion struct {
+	DeviceID     string `json:"deviceId"`
+	Name         string `json:"name"`
+	Quantity     int    `json:"quantity"`
+	RotationAxes int    `json:"rotationAxes"`
+	PositionAxes int    `json:"positionAxes"`
+}
+
+// MotionCapacity is the result of POST /v1/planning/motion.
+type MotionCapacity struct {
+	RotationAxes AxisBalance `json:"rotationAxes"`
+	PositionAxes AxisBalance `json:"positionAxes"`
+	// Covered is true when the selection provides every required axis.
+	Covered bool `json:"covered"`
+	// Missing are selected ids without a device, NotMotionEnabled are
+	// selected devices without motionEnable. Neither provides axes.
+	Missing          []string `json:"missing"`
+	NotMotionEnabled []string `json:"notMotionEnabled"`
+	// Suggestions are the fewest motion-enabled devices of the catalog that
+	// close the gap. Closable is false when no catalog device has axes of a
+	// missing kind, Suggestions are empty then.
+	Suggestions []MotionSuggestion `json:"suggestions"`
+	Closable    bool               `json:"closable"`
+}
@@ -0,0 +1,84 @@
+package model
+
+// Project is a concrete configuration built from catalog devices. It holds
+// cabinets, cabinets hold racks and the slots of a rack hold devices.
+type Project struct {
+	ID          string    `bson:"_id" json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Cabinets    []Cabinet `json:"cabinets"`
+	// Version counts the changes of the project. A replacement has to carry
+	// the stored version, so concurrent changes cannot overwrite each other.
+	Version int `json:"version"`
+}
+
+// Cabinet is an enclosure of a project. Its ID is unique within the project.
+type Cabinet struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Is19Inch marks a 19 inch cabinet, its racks only take devices with
+	// insertInto19InchCabinet.
+	Is19Inch bool   `json:"is19Inch"`
+	Racks    []Rack `json:"racks"`
+}
+
+// Rack is a rack of a cabinet with SlotCount slots numbered from 1. Its ID
+// is unique within the cabinet.
+type Rack struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	SlotCount int    `json:"slotCount"`
+	// Slots are the occupied slots, empty ones are left out.
+	Slots []Slot `json:"slots"`
+}
+
+// Slot places a catalog device into a slot of a rack.
+type Slot struct {
+	Number   int    `json:"number"`
+	DeviceID string `json:"deviceId"`
+}
+
+type Projects struct {
+	Projects []Project `json:"projects"`
+}
+
+type Cabinets struct {
+	Cabinets []Cabinet `json:"cabinets"`
+}
+
+type Racks struct {
+	Racks []Rack `json:"racks"`
+}
+
+// ProjectView is a project with the devices of its slots resolved, the
+// result of GET /v1/projects/{id}/view. Missing are the referenced device
+// ids that are not in the catalog anymore.
+type ProjectView struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Cabinets    []CabinetView `json:"cabinets"`
+	Missing     []string      `json:"missing"`
+}
+
+type CabinetView struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Is19Inch bool       `json:"is19Inch"`
+	Racks    []RackView `json:"racks"`
+}
+
+type RackView struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	SlotCount int        `json:"slotCount"`
+	Slots     []SlotView `json:"slots"`
+}
+
+// SlotView is a slot with its device, which is nil when the device is
+// missing.
+type SlotView struct {
+	Number   int     `json:"number"`
+	DeviceID string  `json:"deviceId"`
+	Device   *Device `json:"device"`
+}